@@ -0,0 +1,168 @@
+// Package certs inspects the certificates and keys of SSL profiles, so
+// profiles that are broken, expired or about to expire can be reported and
+// kept from being pushed to the router.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/datasance/router/internal/qdr"
+)
+
+// State summarizes the certificates of a profile.
+type State string
+
+const (
+	StateValid    State = "valid"
+	StateExpiring State = "expiring"
+	StateExpired  State = "expired"
+	// StateInvalid is a profile whose files cannot be read or parsed, whose
+	// key does not match its certificate, or that is not valid yet
+	StateInvalid State = "invalid"
+)
+
+// Certificate describes a certificate found in a profile file.
+type Certificate struct {
+	// File is ca for the CA certificate file and cert for the certificate file
+	File        string    `json:"file"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dnsNames,omitempty"`
+	IPAddresses []string  `json:"ipAddresses,omitempty"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// Report is the result of inspecting an SSL profile.
+type Report struct {
+	Profile      string        `json:"profile"`
+	State        State         `json:"state"`
+	Certificates []Certificate `json:"certificates,omitempty"`
+	Problems     []string      `json:"problems,omitempty"`
+}
+
+// EarliestExpiry returns when the first certificate in the given file expires,
+// or false if the file has no certificates.
+func (r Report) EarliestExpiry(file string) (time.Time, bool) {
+	var earliest time.Time
+	for _, c := range r.Certificates {
+		if c.File == file && (earliest.IsZero() || c.NotAfter.Before(earliest)) {
+			earliest = c.NotAfter
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// Inspect parses the certificates of profile and checks its key matches its
+// certificate. Certificates expiring within warning of now make the profile
+// expiring.
+func Inspect(profile qdr.SslProfile, now time.Time, warning time.Duration) Report {
+	report := Report{Profile: profile.Name}
+	for _, file := range []struct{ kind, path string }{{"ca", profile.CaCertFile}, {"cert", profile.CertFile}} {
+		if file.path == "" {
+			continue
+		}
+		certificates, err := ReadCertificates(file.path)
+		if err != nil {
+			report.Problems = append(report.Problems, err.Error())
+			continue
+		}
+		for _, c := range certificates {
+			report.Certificates = append(report.Certificates, describe(file.kind, c))
+		}
+	}
+	if err := CheckKeyPair(profile); err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	}
+	report.State = StateValid
+	for _, c := range report.Certificates {
+		switch {
+		case now.Before(c.NotBefore):
+			report.Problems = append(report.Problems, fmt.Sprintf("%s certificate %s is not valid before %s", c.File, c.Subject, c.NotBefore.Format(time.RFC3339)))
+		case now.After(c.NotAfter):
+			report.State = StateExpired
+		case report.State == StateValid && now.Add(warning).After(c.NotAfter):
+			report.State = StateExpiring
+		}
+	}
+	if len(report.Problems) > 0 {
+		report.State = StateInvalid
+	}
+	return report
+}
+
+// InspectAll inspects each profile, in order of name.
+func InspectAll(profiles map[string]qdr.SslProfile, now time.Time, warning time.Duration) []Report {
+	names := slices.Sorted(maps.Keys(profiles))
+	reports := make([]Report, len(names))
+	for i, name := range names {
+		reports[i] = Inspect(profiles[name], now, warning)
+	}
+	return reports
+}
+
+// CheckKeyPair returns an error if the profile has a certificate and key that
+// cannot be loaded together, e.g. while only one of them has been rotated.
+func CheckKeyPair(profile qdr.SslProfile) error {
+	if profile.PrivateKeyFile == "" {
+		return nil
+	}
+	if profile.CertFile == "" {
+		return fmt.Errorf("profile %s has a key but no certificate", profile.Name)
+	}
+	if _, err := tls.LoadX509KeyPair(profile.CertFile, profile.PrivateKeyFile); err != nil {
+		return fmt.Errorf("key pair of profile %s is not usable: %v", profile.Name, err)
+	}
+	return nil
+}
+
+// ReadCertificates returns the certificates in a PEM file, which must have at
+// least one.
+func ReadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %s: %v", path, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certificates, nil
+}
+
+func describe(file string, c *x509.Certificate) Certificate {
+	result := Certificate{
+		File:      file,
+		Subject:   c.Subject.String(),
+		Issuer:    c.Issuer.String(),
+		DNSNames:  c.DNSNames,
+		NotBefore: c.NotBefore,
+		NotAfter:  c.NotAfter,
+	}
+	for _, ip := range c.IPAddresses {
+		result.IPAddresses = append(result.IPAddresses, ip.String())
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/qdr"
+)
+
+// writeKeyPair writes a self-signed certificate valid from notBefore to
+// notAfter to dir/name.crt and its key to dir/name.key.
+func writeKeyPair(t *testing.T, dir string, name string, notBefore time.Time, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name + ".example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeKeyPair(t, dir, "good", now.Add(-time.Hour), now.Add(90*24*time.Hour))
+	writeKeyPair(t, dir, "soon", now.Add(-time.Hour), now.Add(24*time.Hour))
+	writeKeyPair(t, dir, "old", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	writeKeyPair(t, dir, "future", now.Add(time.Hour), now.Add(48*time.Hour))
+	profile := func(name string, key string) qdr.SslProfile {
+		return qdr.SslProfile{
+			Name:           name,
+			CaCertFile:     filepath.Join(dir, name+".crt"),
+			CertFile:       filepath.Join(dir, name+".crt"),
+			PrivateKeyFile: filepath.Join(dir, key+".key"),
+		}
+	}
+
+	good := Inspect(profile("good", "good"), now, 30*24*time.Hour)
+	if good.State != StateValid || len(good.Problems) != 0 || len(good.Certificates) != 2 {
+		t.Fatalf("good = %+v, want valid with ca and cert", good)
+	}
+	c := good.Certificates[1]
+	if c.File != "cert" || c.Subject != "CN=good" || c.Issuer != "CN=good" || c.DNSNames[0] != "good.example.com" || c.IPAddresses[0] != "10.0.0.1" {
+		t.Errorf("certificate = %+v", c)
+	}
+	if expiry, ok := good.EarliestExpiry("ca"); !ok || !expiry.Equal(c.NotAfter) {
+		t.Errorf("EarliestExpiry() = %v, %v", expiry, ok)
+	}
+
+	for _, tc := range []struct {
+		profile qdr.SslProfile
+		state   State
+		problem string
+	}{
+		{profile("soon", "soon"), StateExpiring, ""},
+		{profile("old", "old"), StateExpired, ""},
+		{profile("future", "future"), StateInvalid, "not valid before"},
+		{profile("good", "soon"), StateInvalid, "key pair of profile good is not usable"},
+		{qdr.SslProfile{Name: "keyonly", PrivateKeyFile: filepath.Join(dir, "good.key")}, StateInvalid, "has a key but no certificate"},
+		{qdr.SslProfile{Name: "missing", CaCertFile: filepath.Join(dir, "missing.crt")}, StateInvalid, "missing.crt"},
+	} {
+		report := Inspect(tc.profile, now, 30*24*time.Hour)
+		if report.State != tc.state || (tc.problem != "" && !strings.Contains(strings.Join(report.Problems, ";"), tc.problem)) {
+			t.Errorf("Inspect(%s) = %+v, want %s with %q", tc.profile.Name, report, tc.state, tc.problem)
+		}
+	}
+}
+
+func TestCheckKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyPair(t, dir, "a", time.Now(), time.Now().Add(time.Hour))
+	writeKeyPair(t, dir, "b", time.Now(), time.Now().Add(time.Hour))
+	if err := CheckKeyPair(qdr.SslProfile{Name: "ca-only", CaCertFile: filepath.Join(dir, "a.crt")}); err != nil {
+		t.Errorf("profile without key: %v", err)
+	}
+	if err := CheckKeyPair(qdr.SslProfile{Name: "a", CertFile: filepath.Join(dir, "a.crt"), PrivateKeyFile: filepath.Join(dir, "a.key")}); err != nil {
+		t.Errorf("matching key pair: %v", err)
+	}
+	if err := CheckKeyPair(qdr.SslProfile{Name: "mixed", CertFile: filepath.Join(dir, "a.crt"), PrivateKeyFile: filepath.Join(dir, "b.key")}); err == nil {
+		t.Errorf("expected error for key that does not match certificate")
+	}
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/datasance/router/internal/resources/types"
 )
@@ -9,6 +12,22 @@ import (
 const (
 	DefaultConfigPath     = "/tmp/skrouterd.json"
 	DefaultSSLProfilePath = "/etc/skupper-router-certs"
+	// DefaultInlineSslProfilePath is kept apart from DefaultSSLProfilePath, as
+	// that directory is watched for profiles
+	DefaultInlineSslProfilePath = "/tmp/skrouterd-certs"
+	DefaultStatusAddress        = ":9191"
+	DefaultManagementUrl        = "amqp://localhost:5672"
+
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartMaxBackoff = 30 * time.Second
+	DefaultRestartLimit      = 5
+	DefaultRestartWindow     = 5 * time.Minute
+	DefaultDrainTimeout      = 20 * time.Second
+	DefaultCertExpiryWarning = 30 * 24 * time.Hour
+	DefaultResyncInterval    = 5 * time.Minute
+
+	DefaultManagementPoolSize    = 10
+	DefaultManagementIdleTimeout = 5 * time.Minute
 )
 
 // GetConfigPath returns the router config file path from QDROUTERD_CONF,
@@ -28,3 +47,173 @@ func GetSSLProfilePath() string {
 	}
 	return DefaultSSLProfilePath
 }
+
+// GetInlineSslProfilePath returns the directory the inline PEM content of SSL
+// profiles is written to (ROUTER_INLINE_SSL_PROFILE_PATH env), or
+// DefaultInlineSslProfilePath if unset.
+func GetInlineSslProfilePath() string {
+	if p := os.Getenv(types.EnvInlineSslProfilePath); p != "" {
+		return p
+	}
+	return DefaultInlineSslProfilePath
+}
+
+// GetStatusAddress returns the address the health and status server listens on
+// (ROUTER_STATUS_ADDRESS env), or DefaultStatusAddress if unset.
+func GetStatusAddress() string {
+	if a := os.Getenv(types.EnvRouterStatusAddress); a != "" {
+		return a
+	}
+	return DefaultStatusAddress
+}
+
+// GetManagementUrl returns the URL of the router's AMQP management listener
+// (ROUTER_MANAGEMENT_URL env), or DefaultManagementUrl if unset. Use an amqps
+// URL to connect with TLS.
+func GetManagementUrl() string {
+	if u := os.Getenv(types.EnvManagementUrl); u != "" {
+		return u
+	}
+	return DefaultManagementUrl
+}
+
+// GetManagementSslProfile returns the name of the profile under SSL_PROFILE_PATH
+// holding the CA and client certificate for the management connection
+// (ROUTER_MANAGEMENT_SSL_PROFILE env), or "" for none.
+func GetManagementSslProfile() string {
+	return os.Getenv(types.EnvManagementSslProfile)
+}
+
+// GetManagementSaslMechanism returns the SASL mechanism for the management
+// connection (ROUTER_MANAGEMENT_SASL_MECHANISM env): ANONYMOUS, PLAIN or
+// EXTERNAL. If unset, EXTERNAL is used with a client certificate and no SASL
+// otherwise.
+func GetManagementSaslMechanism() string {
+	return os.Getenv(types.EnvManagementSasl)
+}
+
+// GetManagementCredentials returns the username and password for SASL PLAIN
+// (ROUTER_MANAGEMENT_USERNAME and ROUTER_MANAGEMENT_PASSWORD env).
+func GetManagementCredentials() (string, string) {
+	return os.Getenv(types.EnvManagementUsername), os.Getenv(types.EnvManagementPassword)
+}
+
+// GetManagementPoolSize returns the maximum number of management connections
+// (ROUTER_MANAGEMENT_POOL_SIZE env), or DefaultManagementPoolSize if unset.
+func GetManagementPoolSize() int {
+	return getIntEnv(types.EnvManagementPoolSize, DefaultManagementPoolSize)
+}
+
+// GetManagementIdleTimeout returns how long a management connection may stay
+// idle before it is closed (ROUTER_MANAGEMENT_IDLE_TIMEOUT env), or
+// DefaultManagementIdleTimeout if unset.
+func GetManagementIdleTimeout() time.Duration {
+	return getDurationEnv(types.EnvManagementIdle, DefaultManagementIdleTimeout)
+}
+
+// GetRestartBackoff returns the delay before the router process is first
+// restarted (ROUTER_RESTART_BACKOFF env), or DefaultRestartBackoff if unset
+// or not positive.
+func GetRestartBackoff() time.Duration {
+	return getPositiveDurationEnv(types.EnvRouterRestartBackoff, DefaultRestartBackoff)
+}
+
+// GetRestartMaxBackoff returns the upper bound of the restart delay
+// (ROUTER_RESTART_MAX_BACKOFF env), or DefaultRestartMaxBackoff if unset or
+// not positive. It is never less than GetRestartBackoff.
+func GetRestartMaxBackoff() time.Duration {
+	maxBackoff := getPositiveDurationEnv(types.EnvRouterRestartMaxDelay, DefaultRestartMaxBackoff)
+	if backoff := GetRestartBackoff(); maxBackoff < backoff {
+		log.Printf("WARN: %s %s is less than %s %s, using %s", types.EnvRouterRestartMaxDelay, maxBackoff, types.EnvRouterRestartBackoff, backoff, backoff)
+		return backoff
+	}
+	return maxBackoff
+}
+
+// GetRestartLimit returns how many restarts are allowed within the restart
+// window before the wrapper gives up (ROUTER_RESTART_LIMIT env), or
+// DefaultRestartLimit if unset. A negative value means no limit.
+func GetRestartLimit() int {
+	return getIntEnv(types.EnvRouterRestartLimit, DefaultRestartLimit)
+}
+
+// GetRestartWindow returns the window over which restarts are counted
+// (ROUTER_RESTART_WINDOW env), or DefaultRestartWindow if unset.
+func GetRestartWindow() time.Duration {
+	return getDurationEnv(types.EnvRouterRestartWindow, DefaultRestartWindow)
+}
+
+// GetDrainTimeout returns how long to wait for tcp flows to finish on shutdown
+// (ROUTER_DRAIN_TIMEOUT env), or DefaultDrainTimeout if unset.
+func GetDrainTimeout() time.Duration {
+	return getDurationEnv(types.EnvRouterDrainTimeout, DefaultDrainTimeout)
+}
+
+// GetConfigStrict returns true if router config files with unknown entity
+// types or attributes are rejected rather than applied with a warning
+// (ROUTER_CONFIG_STRICT env).
+func GetConfigStrict() bool {
+	return getBoolEnv(types.EnvRouterConfigStrict, false)
+}
+
+// GetCertExpiryWarning returns how long before a certificate expires its SSL
+// profile is reported as expiring (ROUTER_CERT_EXPIRY_WARNING env), or
+// DefaultCertExpiryWarning if unset.
+func GetCertExpiryWarning() time.Duration {
+	return getDurationEnv(types.EnvCertExpiryWarning, DefaultCertExpiryWarning)
+}
+
+// GetResyncInterval returns how often the running router is compared with the
+// config and drift is corrected (ROUTER_RESYNC_INTERVAL env), or
+// DefaultResyncInterval if unset. 0 disables the resync.
+func GetResyncInterval() time.Duration {
+	return getDurationEnv(types.EnvRouterResyncInterval, DefaultResyncInterval)
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("WARN: Invalid duration %q for %s, using %s", v, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getPositiveDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	d := getDurationEnv(key, defaultValue)
+	if d <= 0 {
+		log.Printf("WARN: Duration %s for %s is not positive, using %s", d, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("WARN: Invalid integer %q for %s, using %d", v, key, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("WARN: Invalid boolean %q for %s, using %t", v, key, defaultValue)
+		return defaultValue
+	}
+	return b
+}
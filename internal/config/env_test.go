@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/datasance/router/internal/resources/types"
 )
@@ -42,3 +43,220 @@ func TestGetSSLProfilePath(t *testing.T) {
 		t.Errorf("GetSSLProfilePath() with env set = %q, want %q", got, want)
 	}
 }
+
+func TestGetRestartPolicyEnv(t *testing.T) {
+	keys := []string{
+		types.EnvRouterRestartBackoff,
+		types.EnvRouterRestartMaxDelay,
+		types.EnvRouterRestartLimit,
+		types.EnvRouterRestartWindow,
+	}
+	defer func() {
+		for _, key := range keys {
+			_ = os.Unsetenv(key)
+		}
+	}()
+
+	// Defaults when unset
+	for _, key := range keys {
+		os.Unsetenv(key)
+	}
+	if got := GetRestartBackoff(); got != DefaultRestartBackoff {
+		t.Errorf("GetRestartBackoff() with unset env = %v, want %v", got, DefaultRestartBackoff)
+	}
+	if got := GetRestartMaxBackoff(); got != DefaultRestartMaxBackoff {
+		t.Errorf("GetRestartMaxBackoff() with unset env = %v, want %v", got, DefaultRestartMaxBackoff)
+	}
+	if got := GetRestartLimit(); got != DefaultRestartLimit {
+		t.Errorf("GetRestartLimit() with unset env = %v, want %v", got, DefaultRestartLimit)
+	}
+	if got := GetRestartWindow(); got != DefaultRestartWindow {
+		t.Errorf("GetRestartWindow() with unset env = %v, want %v", got, DefaultRestartWindow)
+	}
+
+	// Uses env when set
+	os.Setenv(types.EnvRouterRestartBackoff, "250ms")
+	os.Setenv(types.EnvRouterRestartMaxDelay, "1m")
+	os.Setenv(types.EnvRouterRestartLimit, "-1")
+	os.Setenv(types.EnvRouterRestartWindow, "10m")
+	if got := GetRestartBackoff(); got != 250*time.Millisecond {
+		t.Errorf("GetRestartBackoff() with env set = %v, want 250ms", got)
+	}
+	if got := GetRestartMaxBackoff(); got != time.Minute {
+		t.Errorf("GetRestartMaxBackoff() with env set = %v, want 1m", got)
+	}
+	if got := GetRestartLimit(); got != -1 {
+		t.Errorf("GetRestartLimit() with env set = %v, want -1", got)
+	}
+	if got := GetRestartWindow(); got != 10*time.Minute {
+		t.Errorf("GetRestartWindow() with env set = %v, want 10m", got)
+	}
+
+	// Falls back to default on invalid values
+	os.Setenv(types.EnvRouterRestartBackoff, "soon")
+	os.Setenv(types.EnvRouterRestartLimit, "many")
+	if got := GetRestartBackoff(); got != DefaultRestartBackoff {
+		t.Errorf("GetRestartBackoff() with invalid env = %v, want %v", got, DefaultRestartBackoff)
+	}
+	if got := GetRestartLimit(); got != DefaultRestartLimit {
+		t.Errorf("GetRestartLimit() with invalid env = %v, want %v", got, DefaultRestartLimit)
+	}
+
+	// Falls back to default on values that are not positive
+	os.Setenv(types.EnvRouterRestartBackoff, "0s")
+	os.Setenv(types.EnvRouterRestartMaxDelay, "-1s")
+	if got := GetRestartBackoff(); got != DefaultRestartBackoff {
+		t.Errorf("GetRestartBackoff() with zero env = %v, want %v", got, DefaultRestartBackoff)
+	}
+	if got := GetRestartMaxBackoff(); got != DefaultRestartMaxBackoff {
+		t.Errorf("GetRestartMaxBackoff() with negative env = %v, want %v", got, DefaultRestartMaxBackoff)
+	}
+
+	// Max backoff is never less than the initial backoff
+	os.Setenv(types.EnvRouterRestartBackoff, "10s")
+	os.Setenv(types.EnvRouterRestartMaxDelay, "2s")
+	if got := GetRestartMaxBackoff(); got != 10*time.Second {
+		t.Errorf("GetRestartMaxBackoff() below backoff = %v, want 10s", got)
+	}
+}
+
+func TestGetDrainTimeout(t *testing.T) {
+	defer os.Unsetenv(types.EnvRouterDrainTimeout)
+
+	os.Unsetenv(types.EnvRouterDrainTimeout)
+	if got := GetDrainTimeout(); got != DefaultDrainTimeout {
+		t.Errorf("GetDrainTimeout() with unset env = %v, want %v", got, DefaultDrainTimeout)
+	}
+	os.Setenv(types.EnvRouterDrainTimeout, "0s")
+	if got := GetDrainTimeout(); got != 0 {
+		t.Errorf("GetDrainTimeout() with env set = %v, want 0s", got)
+	}
+}
+
+func TestGetStatusAddress(t *testing.T) {
+	defer os.Unsetenv(types.EnvRouterStatusAddress)
+
+	os.Unsetenv(types.EnvRouterStatusAddress)
+	if got := GetStatusAddress(); got != DefaultStatusAddress {
+		t.Errorf("GetStatusAddress() with unset env = %q, want %q", got, DefaultStatusAddress)
+	}
+	os.Setenv(types.EnvRouterStatusAddress, "127.0.0.1:8080")
+	if got := GetStatusAddress(); got != "127.0.0.1:8080" {
+		t.Errorf("GetStatusAddress() with env set = %q, want 127.0.0.1:8080", got)
+	}
+}
+
+func TestGetManagementEnv(t *testing.T) {
+	keys := []string{
+		types.EnvManagementUrl,
+		types.EnvManagementSslProfile,
+		types.EnvManagementSasl,
+		types.EnvManagementUsername,
+		types.EnvManagementPassword,
+		types.EnvManagementPoolSize,
+		types.EnvManagementIdle,
+	}
+	defer func() {
+		for _, key := range keys {
+			_ = os.Unsetenv(key)
+		}
+	}()
+
+	for _, key := range keys {
+		os.Unsetenv(key)
+	}
+	if got := GetManagementUrl(); got != DefaultManagementUrl {
+		t.Errorf("GetManagementUrl() with unset env = %q, want %q", got, DefaultManagementUrl)
+	}
+	if got := GetManagementSslProfile(); got != "" {
+		t.Errorf("GetManagementSslProfile() with unset env = %q, want empty", got)
+	}
+	if got := GetManagementPoolSize(); got != DefaultManagementPoolSize {
+		t.Errorf("GetManagementPoolSize() with unset env = %d, want %d", got, DefaultManagementPoolSize)
+	}
+	if got := GetManagementIdleTimeout(); got != DefaultManagementIdleTimeout {
+		t.Errorf("GetManagementIdleTimeout() with unset env = %v, want %v", got, DefaultManagementIdleTimeout)
+	}
+
+	os.Setenv(types.EnvManagementUrl, "amqps://localhost:5671")
+	os.Setenv(types.EnvManagementSslProfile, "management")
+	os.Setenv(types.EnvManagementSasl, "PLAIN")
+	os.Setenv(types.EnvManagementUsername, "admin")
+	os.Setenv(types.EnvManagementPassword, "secret")
+	if got := GetManagementUrl(); got != "amqps://localhost:5671" {
+		t.Errorf("GetManagementUrl() with env set = %q", got)
+	}
+	if got := GetManagementSslProfile(); got != "management" {
+		t.Errorf("GetManagementSslProfile() with env set = %q", got)
+	}
+	if got := GetManagementSaslMechanism(); got != "PLAIN" {
+		t.Errorf("GetManagementSaslMechanism() with env set = %q", got)
+	}
+	if user, password := GetManagementCredentials(); user != "admin" || password != "secret" {
+		t.Errorf("GetManagementCredentials() with env set = %q, %q", user, password)
+	}
+	os.Setenv(types.EnvManagementPoolSize, "2")
+	os.Setenv(types.EnvManagementIdle, "30s")
+	if got := GetManagementPoolSize(); got != 2 {
+		t.Errorf("GetManagementPoolSize() with env set = %d, want 2", got)
+	}
+	if got := GetManagementIdleTimeout(); got != 30*time.Second {
+		t.Errorf("GetManagementIdleTimeout() with env set = %v, want 30s", got)
+	}
+}
+
+func TestGetConfigStrict(t *testing.T) {
+	defer os.Unsetenv(types.EnvRouterConfigStrict)
+
+	os.Unsetenv(types.EnvRouterConfigStrict)
+	if GetConfigStrict() {
+		t.Errorf("GetConfigStrict() with unset env = true, want false")
+	}
+	os.Setenv(types.EnvRouterConfigStrict, "true")
+	if !GetConfigStrict() {
+		t.Errorf("GetConfigStrict() with env true = false, want true")
+	}
+	os.Setenv(types.EnvRouterConfigStrict, "sometimes")
+	if GetConfigStrict() {
+		t.Errorf("GetConfigStrict() with invalid env = true, want false")
+	}
+}
+
+func TestGetInlineSslProfilePath(t *testing.T) {
+	defer os.Unsetenv(types.EnvInlineSslProfilePath)
+
+	os.Unsetenv(types.EnvInlineSslProfilePath)
+	if got := GetInlineSslProfilePath(); got != DefaultInlineSslProfilePath {
+		t.Errorf("GetInlineSslProfilePath() with unset env = %q, want %q", got, DefaultInlineSslProfilePath)
+	}
+	os.Setenv(types.EnvInlineSslProfilePath, "/run/router-certs")
+	if got := GetInlineSslProfilePath(); got != "/run/router-certs" {
+		t.Errorf("GetInlineSslProfilePath() with env set = %q, want /run/router-certs", got)
+	}
+}
+
+func TestGetCertExpiryWarning(t *testing.T) {
+	defer os.Unsetenv(types.EnvCertExpiryWarning)
+
+	os.Unsetenv(types.EnvCertExpiryWarning)
+	if got := GetCertExpiryWarning(); got != DefaultCertExpiryWarning {
+		t.Errorf("GetCertExpiryWarning() with unset env = %v, want %v", got, DefaultCertExpiryWarning)
+	}
+	os.Setenv(types.EnvCertExpiryWarning, "168h")
+	if got := GetCertExpiryWarning(); got != 168*time.Hour {
+		t.Errorf("GetCertExpiryWarning() with env set = %v, want 168h", got)
+	}
+}
+
+func TestGetResyncInterval(t *testing.T) {
+	defer os.Unsetenv(types.EnvRouterResyncInterval)
+
+	os.Unsetenv(types.EnvRouterResyncInterval)
+	if got := GetResyncInterval(); got != DefaultResyncInterval {
+		t.Errorf("GetResyncInterval() with unset env = %v, want %v", got, DefaultResyncInterval)
+	}
+	os.Setenv(types.EnvRouterResyncInterval, "0s")
+	if got := GetResyncInterval(); got != 0 {
+		t.Errorf("GetResyncInterval() with env set = %v, want 0s", got)
+	}
+}
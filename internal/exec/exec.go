@@ -14,47 +14,274 @@
 package exec
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/datasance/router/internal/utils"
 )
 
-func Run(ch chan<- error, command string, args []string, env []string) {
-	// log.Printf("Running command: %s with args: %v and env vars: %v", command, args, env)
+// ErrCrashLoop is returned by Supervisor.Run when the process exits more often
+// than the restart policy allows.
+var ErrCrashLoop = errors.New("crash loop limit reached")
+
+var errStopped = errors.New("supervisor stopped")
+
+// RestartPolicy controls how a Supervisor restarts its process.
+type RestartPolicy struct {
+	// InitialBackoff is the delay before the first restart. It doubles after
+	// each exit, up to MaxBackoff, and is reset once the process stays up
+	// for longer than MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRestarts is the number of restarts allowed within Window before the
+	// supervisor gives up. Zero never restarts, negative always restarts.
+	MaxRestarts int
+	Window      time.Duration
+}
+
+func DefaultRestartPolicy() RestartPolicy {
+	return RestartPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		MaxRestarts:    5,
+		Window:         5 * time.Minute,
+	}
+}
 
-	cmd := exec.Command(command, args...)
-	cmd.Env = append(os.Environ(), env...)
+// ExitStatus describes how the supervised process exited.
+type ExitStatus struct {
+	// Code is -1 when the process was terminated by a signal
+	Code     int
+	Signal   string
+	Err      error
+	Uptime   time.Duration
+	ExitedAt time.Time
+	signal   syscall.Signal
+}
 
-	outReader, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
+// ExitCode returns the code a shell would report for the exit, which is
+// 128 plus the signal number when the process was terminated by a signal.
+func (e *ExitStatus) ExitCode() int {
+	if e.Signal != "" {
+		return 128 + int(e.signal)
 	}
-	outScanner := bufio.NewScanner(outReader)
+	if e.Code < 0 {
+		return 1
+	}
+	return e.Code
+}
+
+func (e *ExitStatus) String() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("terminated by signal %s after %s", e.Signal, e.Uptime.Round(time.Millisecond))
+	}
+	if e.Code < 0 && e.Err != nil {
+		return fmt.Sprintf("failed: %s", e.Err)
+	}
+	return fmt.Sprintf("exited with code %d after %s", e.Code, e.Uptime.Round(time.Millisecond))
+}
+
+// Supervisor runs a process and restarts it with exponential backoff when it
+// exits, until it is stopped or the crash-loop limit is reached.
+type Supervisor struct {
+	command string
+	args    []string
+	env     []string
+	policy  RestartPolicy
+	// OnRestart, if set, is called in its own goroutine after each restart
+	OnRestart func(restarts int)
+
+	mu        sync.Mutex
+	cmd       *exec.Cmd
+	done      chan struct{}
+	startedAt time.Time
+	stopping  bool
+	stopSig   os.Signal
+	restarts  int
+	lastExit  *ExitStatus
+}
+
+func NewSupervisor(command string, args []string, env []string, policy RestartPolicy) *Supervisor {
+	return &Supervisor{
+		command: command,
+		args:    args,
+		env:     env,
+		policy:  policy,
+	}
+}
+
+func (s *Supervisor) start() error {
+	cmd := exec.Command(s.command, s.args...)
+	cmd.Env = append(os.Environ(), s.env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmd = cmd
+	s.done = make(chan struct{})
+	s.startedAt = time.Now()
+	// Stop was called while the process was being started, before it could
+	// be signalled
+	if s.stopping {
+		_ = cmd.Process.Signal(s.stopSig)
+	}
+	return nil
+}
+
+func (s *Supervisor) wait(ctx context.Context) *ExitStatus {
+	s.mu.Lock()
+	cmd, done, startedAt := s.cmd, s.done, s.startedAt
+	s.mu.Unlock()
+
 	go func() {
-		for outScanner.Scan() {
-			fmt.Println(outScanner.Text())
+		select {
+		case <-ctx.Done():
+			_ = cmd.Process.Signal(syscall.SIGTERM)
+		case <-done:
 		}
 	}()
+	err := cmd.Wait()
+	close(done)
 
-	errReader, err := cmd.StderrPipe()
-	if err != nil {
-		log.Fatal(err)
+	status := &ExitStatus{
+		Code:     cmd.ProcessState.ExitCode(),
+		Uptime:   time.Since(startedAt),
+		ExitedAt: time.Now(),
 	}
-	errScanner := bufio.NewScanner(errReader)
-	go func() {
-		for errScanner.Scan() {
-			fmt.Println(errScanner.Text())
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		status.Signal = ws.Signal().String()
+		status.signal = ws.Signal()
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		status.Err = err
+	}
+	s.mu.Lock()
+	s.cmd = nil
+	s.lastExit = status
+	s.mu.Unlock()
+	return status
+}
+
+// Run starts the process and supervises it until ctx is cancelled or Stop is
+// called, in which case it returns the final exit status and no error. If the
+// process exits more often than the policy allows, ErrCrashLoop is returned.
+func (s *Supervisor) Run(ctx context.Context) (*ExitStatus, error) {
+	if err := s.start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", s.command, err)
+	}
+	backoff := s.policy.InitialBackoff
+	exits := []time.Time{}
+	for {
+		status := s.wait(ctx)
+		if s.isStopping() || ctx.Err() != nil {
+			log.Printf("INFO: %s %s", s.command, status)
+			return status, nil
 		}
-	}()
+		log.Printf("ERROR: %s %s", s.command, status)
 
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
+		if status.Uptime > s.policy.MaxBackoff {
+			backoff = s.policy.InitialBackoff
+		}
+		exits = append(recentExits(exits, status.ExitedAt, s.policy.Window), status.ExitedAt)
+		if s.policy.MaxRestarts >= 0 && len(exits) > s.policy.MaxRestarts {
+			return status, fmt.Errorf("%w: %d exits within %s, last %s", ErrCrashLoop, len(exits), s.policy.Window, status)
+		}
+
+		log.Printf("INFO: Restarting %s in %s", s.command, backoff)
+		err := utils.RetryWithContext(ctx, backoff, func() (bool, error) {
+			if s.isStopping() {
+				return false, errStopped
+			}
+			if err := s.start(); err != nil {
+				log.Printf("ERROR: Failed to restart %s: %v", s.command, err)
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			// Stopped or cancelled while waiting to restart
+			return status, nil
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		restarts := s.restarts
+		s.mu.Unlock()
+		if s.OnRestart != nil {
+			go s.OnRestart(restarts)
+		}
+		backoff *= 2
+		if backoff > s.policy.MaxBackoff {
+			backoff = s.policy.MaxBackoff
+		}
+	}
+}
+
+func recentExits(exits []time.Time, now time.Time, window time.Duration) []time.Time {
+	recent := []time.Time{}
+	for _, t := range exits {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
 	}
+	return recent
+}
 
-	if err := cmd.Wait(); err != nil {
-		log.Fatal(err)
+func (s *Supervisor) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// Signal sends sig to the process if it is running.
+func (s *Supervisor) Signal(sig os.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd == nil || s.cmd.Process == nil {
+		return fmt.Errorf("%s is not running", s.command)
 	}
-	ch <- err
+	return s.cmd.Process.Signal(sig)
+}
+
+// Stop prevents further restarts and sends sig to the process, or to the
+// process being started if there is none yet. Run returns once the process
+// has exited.
+func (s *Supervisor) Stop(sig os.Signal) error {
+	s.mu.Lock()
+	s.stopping = true
+	s.stopSig = sig
+	s.mu.Unlock()
+	return s.Signal(sig)
+}
+
+// Running returns true while the process is running.
+func (s *Supervisor) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cmd != nil
+}
+
+// Restarts returns the number of times the process was restarted.
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// LastExit returns how the process last exited, or nil if it has not exited.
+func (s *Supervisor) LastExit() *ExitStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastExit
 }
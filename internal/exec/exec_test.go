@@ -0,0 +1,168 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeRouter writes a shell script standing in for skrouterd.
+func fakeRouter(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "skrouterd.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testPolicy(maxRestarts int) RestartPolicy {
+	return RestartPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		MaxRestarts:    maxRestarts,
+		Window:         time.Minute,
+	}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	s := NewSupervisor(fakeRouter(t, "exit 3"), nil, nil, testPolicy(2))
+	var restarted atomic.Int32
+	s.OnRestart = func(int) { restarted.Add(1) }
+
+	status, err := s.Run(context.Background())
+	if !errors.Is(err, ErrCrashLoop) {
+		t.Fatalf("Run() error = %v, want ErrCrashLoop", err)
+	}
+	if status == nil || status.Code != 3 || status.Signal != "" || status.ExitCode() != 3 {
+		t.Errorf("exit status = %v, want code 3", status)
+	}
+	if s.Restarts() != 2 {
+		t.Errorf("Restarts() = %d, want 2", s.Restarts())
+	}
+	if s.Running() {
+		t.Errorf("Running() = true after giving up")
+	}
+	deadline := time.Now().Add(time.Second)
+	for restarted.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if restarted.Load() != 2 {
+		t.Errorf("OnRestart called %d times, want 2", restarted.Load())
+	}
+}
+
+func TestSupervisorCapturesSignal(t *testing.T) {
+	s := NewSupervisor(fakeRouter(t, "kill -KILL $$"), nil, nil, testPolicy(0))
+	status, err := s.Run(context.Background())
+	if !errors.Is(err, ErrCrashLoop) {
+		t.Fatalf("Run() error = %v, want ErrCrashLoop", err)
+	}
+	if status.Code != -1 || status.Signal != syscall.SIGKILL.String() {
+		t.Errorf("exit status = %v, want killed", status)
+	}
+	if status.ExitCode() != 128+int(syscall.SIGKILL) {
+		t.Errorf("ExitCode() = %d, want %d", status.ExitCode(), 128+int(syscall.SIGKILL))
+	}
+}
+
+func TestSupervisorRestartsThenStops(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "starts")
+	// Crash on the first start, then stay up
+	script := `echo x >> ` + counter + `
+if [ "$(wc -l < ` + counter + `)" -lt 2 ]; then exit 1; fi
+exec sleep 30`
+	s := NewSupervisor(fakeRouter(t, script), nil, nil, testPolicy(5))
+	restarted := make(chan int, 1)
+	s.OnRestart = func(restarts int) { restarted <- restarts }
+
+	result := make(chan error, 1)
+	var status *ExitStatus
+	go func() {
+		var err error
+		status, err = s.Run(context.Background())
+		result <- err
+	}()
+
+	select {
+	case n := <-restarted:
+		if n != 1 {
+			t.Errorf("OnRestart(%d), want 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("process was not restarted")
+	}
+	if !s.Running() {
+		t.Fatal("Running() = false after restart")
+	}
+	if err := s.Stop(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil after Stop", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	if status.Signal != syscall.SIGTERM.String() {
+		t.Errorf("exit status = %v, want terminated", status)
+	}
+}
+
+func TestSupervisorContextCancelled(t *testing.T) {
+	s := NewSupervisor(fakeRouter(t, "exec sleep 30"), nil, nil, testPolicy(5))
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.Run(ctx)
+		result <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Run() error = %v, want nil after cancel", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if s.Restarts() != 0 {
+		t.Errorf("Restarts() = %d, want 0", s.Restarts())
+	}
+}
+
+func TestSupervisorStoppedBeforeStart(t *testing.T) {
+	s := NewSupervisor(fakeRouter(t, "exec sleep 30"), nil, nil, testPolicy(5))
+	// As when Stop is called while waiting to restart
+	if err := s.Stop(syscall.SIGTERM); err == nil {
+		t.Errorf("Stop() with no process = nil, want not running")
+	}
+	result := make(chan *ExitStatus, 1)
+	go func() {
+		status, _ := s.Run(context.Background())
+		result <- status
+	}()
+	select {
+	case status := <-result:
+		if status == nil || status.Signal != syscall.SIGTERM.String() {
+			t.Errorf("Run() = %v, want process started after Stop to be terminated", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("process started after Stop was not signalled")
+	}
+}
+
+func TestSupervisorStartFailure(t *testing.T) {
+	s := NewSupervisor(filepath.Join(t.TempDir(), "missing"), nil, nil, testPolicy(5))
+	if _, err := s.Run(context.Background()); err == nil {
+		t.Fatal("expected error for missing binary")
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2023 Datasance Teknoloji A.S.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+// Package metrics builds the router metrics and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datasance/router/internal/certs"
+	"github.com/datasance/router/internal/qdr"
+	"github.com/datasance/router/internal/resources/types"
+)
+
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+	Summary = "summary"
+)
+
+type Labels map[string]string
+
+type Sample struct {
+	// Suffix is appended to the family name, e.g. "_sum" for a summary
+	Suffix string
+	Labels Labels
+	Value  float64
+}
+
+// Family is a metric with its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+func (f *Family) Add(value float64, labels Labels) {
+	f.Samples = append(f.Samples, Sample{Labels: labels, Value: value})
+}
+
+// Write writes the families in the Prometheus text format. Families without
+// samples are skipped.
+func Write(w io.Writer, families []Family) error {
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(out, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			out.WriteString(f.Name + s.Suffix)
+			writeLabels(out, s.Labels)
+			out.WriteString(" " + formatValue(s.Value) + "\n")
+		}
+	}
+	return out.Flush()
+}
+
+func writeLabels(out *bufio.Writer, labels Labels) {
+	if len(labels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		fmt.Fprintf(out, "%s=\"%s\"", name, escapeLabel(labels[name]))
+	}
+	out.WriteString("}")
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Up reports whether the router answered management queries.
+func Up(up bool) Family {
+	f := Family{Name: "skrouter_up", Help: "Whether the router answers management queries.", Type: Gauge}
+	f.Add(boolValue(up), nil)
+	return f
+}
+
+// TcpFlows returns the number of active flows and their bytes for each
+// tcpListener and tcpConnector. Flows are matched to endpoints by address:
+// incoming flows belong to the tcpListener, outgoing ones to the tcpConnector.
+// The router does not report which endpoint a flow went through, so a flow is
+// counted under every endpoint with its address and direction; summing over
+// such endpoints counts it more than once.
+func TcpFlows(listeners []qdr.TcpEndpoint, connectors []qdr.TcpEndpoint, connections []qdr.TcpConnection) []Family {
+	type key struct{ kind, name, address string }
+	type usage struct{ flows, bytesIn, bytesOut int }
+	endpoints := map[key]*usage{}
+	byAddress := map[string][]key{}
+	add := func(kind string, direction string, list []qdr.TcpEndpoint) {
+		for _, e := range list {
+			k := key{kind, e.Name, e.Address}
+			endpoints[k] = &usage{}
+			byAddress[direction+"/"+e.Address] = append(byAddress[direction+"/"+e.Address], k)
+		}
+	}
+	add("tcpListener", "in", listeners)
+	add("tcpConnector", "out", connectors)
+	for _, c := range connections {
+		for _, k := range byAddress[c.Direction+"/"+c.Address] {
+			u := endpoints[k]
+			u.flows++
+			u.bytesIn += c.BytesIn
+			u.bytesOut += c.BytesOut
+		}
+	}
+
+	keys := make([]key, 0, len(endpoints))
+	for k := range endpoints {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].name < keys[j].name
+	})
+	flows := Family{Name: "skrouter_tcp_active_flows", Help: "Active flows through a tcpListener or tcpConnector.", Type: Gauge}
+	bytes := Family{Name: "skrouter_tcp_active_flow_bytes", Help: "Bytes transferred by the active flows of a tcpListener or tcpConnector.", Type: Gauge}
+	for _, k := range keys {
+		u := endpoints[k]
+		labels := Labels{"type": k.kind, "name": k.name, "address": k.address}
+		flows.Add(float64(u.flows), labels)
+		bytes.Add(float64(u.bytesIn), Labels{"type": k.kind, "name": k.name, "address": k.address, "direction": "in"})
+		bytes.Add(float64(u.bytesOut), Labels{"type": k.kind, "name": k.name, "address": k.address, "direction": "out"})
+	}
+	return []Family{flows, bytes}
+}
+
+// Connectors returns the status and cost of the inter-router and edge
+// connectors.
+func Connectors(status map[string]qdr.ConnectorStatus) []Family {
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	up := Family{Name: "skrouter_connector_up", Help: "Whether a connector is connected.", Type: Gauge}
+	cost := Family{Name: "skrouter_connector_cost", Help: "Cost of a connector.", Type: Gauge}
+	for _, name := range names {
+		c := status[name]
+		up.Add(boolValue(c.Status == "SUCCESS"), Labels{"name": c.Name, "host": c.Host, "port": c.Port, "role": c.Role})
+		cost.Add(float64(c.Cost), Labels{"name": c.Name})
+	}
+	return []Family{up, cost}
+}
+
+// Network returns the number of routers and sites reachable from this one.
+func Network(routers []qdr.Router, sites types.TransportConnectedSites) []Family {
+	siteIds := map[string]bool{}
+	for _, r := range routers {
+		if r.Site.Id != "" {
+			siteIds[r.Site.Id] = true
+		}
+	}
+	reachable := Family{Name: "skrouter_network_routers", Help: "Routers in the network.", Type: Gauge}
+	reachable.Add(float64(len(routers)), nil)
+	allSites := Family{Name: "skrouter_network_sites", Help: "Sites in the network.", Type: Gauge}
+	allSites.Add(float64(len(siteIds)), nil)
+	connected := Family{Name: "skrouter_connected_sites", Help: "Other sites reachable from this router, directly or through other sites.", Type: Gauge}
+	connected.Add(float64(sites.Direct), Labels{"connection": "direct"})
+	connected.Add(float64(sites.Indirect), Labels{"connection": "indirect"})
+	return []Family{reachable, allSites, connected}
+}
+
+// Reconcile returns the number of config updates and the time spent on them.
+func Reconcile(succeeded int, failed int, durationSum float64) []Family {
+	total := Family{Name: "skrouter_reconcile_total", Help: "Config updates applied to the router.", Type: Counter}
+	total.Add(float64(succeeded), Labels{"result": "success"})
+	total.Add(float64(failed), Labels{"result": "failure"})
+	duration := Family{Name: "skrouter_reconcile_duration_seconds", Help: "Time spent applying config updates to the router.", Type: Summary}
+	duration.Samples = []Sample{
+		{Suffix: "_sum", Value: durationSum},
+		{Suffix: "_count", Value: float64(succeeded + failed)},
+	}
+	return []Family{total, duration}
+}
+
+// Resync returns the number of periodic resyncs and of the entities they
+// corrected, by entity type.
+func Resync(succeeded int, failed int, corrections map[string]int) []Family {
+	total := Family{Name: "skrouter_resync_total", Help: "Periodic resyncs of the router with its config.", Type: Counter}
+	total.Add(float64(succeeded), Labels{"result": "success"})
+	total.Add(float64(failed), Labels{"result": "failure"})
+	corrected := Family{Name: "skrouter_resync_corrections_total", Help: "Router entities created, updated or deleted by resyncs to correct drift.", Type: Counter}
+	types := make([]string, 0, len(corrections))
+	for t := range corrections {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		corrected.Add(float64(corrections[t]), Labels{"type": t})
+	}
+	return []Family{total, corrected}
+}
+
+// Certificates returns the expiry time of the certificates used by the SSL
+// profiles and the state of each profile. For a bundle, the earliest expiry is
+// reported.
+func Certificates(reports []certs.Report) []Family {
+	expiry := Family{Name: "skrouter_ssl_certificate_expiry_timestamp_seconds", Help: "Time at which a certificate of an SSL profile expires.", Type: Gauge}
+	state := Family{Name: "skrouter_ssl_profile_state", Help: "State of the certificates of an SSL profile: valid, expiring, expired or invalid.", Type: Gauge}
+	for _, r := range reports {
+		for _, file := range []string{"ca", "cert"} {
+			if notAfter, ok := r.EarliestExpiry(file); ok {
+				expiry.Add(float64(notAfter.Unix()), Labels{"profile": r.Profile, "file": file})
+			}
+		}
+		state.Add(1, Labels{"profile": r.Profile, "state": string(r.State)})
+	}
+	return []Family{expiry, state}
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/certs"
+	"github.com/datasance/router/internal/qdr"
+	"github.com/datasance/router/internal/resources/types"
+)
+
+func write(t *testing.T, families []Family) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, families); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWrite(t *testing.T) {
+	f := Family{Name: "skrouter_test", Help: "A test\nmetric.", Type: Gauge}
+	f.Add(1.5, Labels{"name": `a "quoted" \ name`, "address": "x"})
+	f.Add(2, nil)
+	empty := Family{Name: "skrouter_empty", Help: "No samples.", Type: Gauge}
+	got := write(t, []Family{f, empty})
+	want := `# HELP skrouter_test A test\nmetric.
+# TYPE skrouter_test gauge
+skrouter_test{address="x",name="a \"quoted\" \\ name"} 1.5
+skrouter_test 2
+`
+	if got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTcpFlows(t *testing.T) {
+	listeners := []qdr.TcpEndpoint{{Name: "web", Address: "web"}}
+	connectors := []qdr.TcpEndpoint{{Name: "db", Address: "db"}, {Name: "idle", Address: "idle"}}
+	connections := []qdr.TcpConnection{
+		{Address: "web", Direction: "in", BytesIn: 10, BytesOut: 20},
+		{Address: "web", Direction: "in", BytesIn: 1, BytesOut: 2},
+		{Address: "db", Direction: "out", BytesIn: 5, BytesOut: 7},
+		{Address: "unknown", Direction: "in", BytesIn: 100},
+	}
+	got := write(t, TcpFlows(listeners, connectors, connections))
+	for _, line := range []string{
+		`skrouter_tcp_active_flows{address="web",name="web",type="tcpListener"} 2`,
+		`skrouter_tcp_active_flows{address="db",name="db",type="tcpConnector"} 1`,
+		`skrouter_tcp_active_flows{address="idle",name="idle",type="tcpConnector"} 0`,
+		`skrouter_tcp_active_flow_bytes{address="web",direction="in",name="web",type="tcpListener"} 11`,
+		`skrouter_tcp_active_flow_bytes{address="web",direction="out",name="web",type="tcpListener"} 22`,
+		`skrouter_tcp_active_flow_bytes{address="db",direction="out",name="db",type="tcpConnector"} 7`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
+
+func TestTcpFlowsSharedAddress(t *testing.T) {
+	// Both listeners expose the same address, so each counts both flows
+	listeners := []qdr.TcpEndpoint{{Name: "web-b", Address: "web"}, {Name: "web-a", Address: "web"}}
+	connections := []qdr.TcpConnection{
+		{Address: "web", Direction: "in", BytesIn: 10, BytesOut: 20},
+		{Address: "web", Direction: "in", BytesIn: 1, BytesOut: 2},
+	}
+	got := write(t, TcpFlows(listeners, nil, connections))
+	for _, line := range []string{
+		`skrouter_tcp_active_flows{address="web",name="web-a",type="tcpListener"} 2`,
+		`skrouter_tcp_active_flows{address="web",name="web-b",type="tcpListener"} 2`,
+		`skrouter_tcp_active_flow_bytes{address="web",direction="in",name="web-a",type="tcpListener"} 11`,
+		`skrouter_tcp_active_flow_bytes{address="web",direction="in",name="web-b",type="tcpListener"} 11`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
+
+func TestConnectorsAndNetwork(t *testing.T) {
+	got := write(t, Connectors(map[string]qdr.ConnectorStatus{
+		"uplink": {Name: "uplink", Host: "interior", Port: "45671", Role: "edge", Cost: 1, Status: "SUCCESS"},
+		"backup": {Name: "backup", Host: "other", Port: "45671", Role: "edge", Cost: 5, Status: "FAILED"},
+	}))
+	for _, line := range []string{
+		`skrouter_connector_up{host="interior",name="uplink",port="45671",role="edge"} 1`,
+		`skrouter_connector_up{host="other",name="backup",port="45671",role="edge"} 0`,
+		`skrouter_connector_cost{name="backup"} 5`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+
+	routers := []qdr.Router{
+		{Id: "a", Site: qdr.SiteMetadata{Id: "site-a"}},
+		{Id: "b", Site: qdr.SiteMetadata{Id: "site-b"}},
+		{Id: "b2", Site: qdr.SiteMetadata{Id: "site-b"}},
+	}
+	got = write(t, Network(routers, types.TransportConnectedSites{Direct: 1, Indirect: 1, Total: 2}))
+	for _, line := range []string{
+		`skrouter_network_routers 3`,
+		`skrouter_network_sites 2`,
+		`skrouter_connected_sites{connection="direct"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	got := write(t, Reconcile(3, 1, 0.25))
+	for _, line := range []string{
+		`skrouter_reconcile_total{result="success"} 3`,
+		`skrouter_reconcile_total{result="failure"} 1`,
+		`skrouter_reconcile_duration_seconds_sum 0.25`,
+		`skrouter_reconcile_duration_seconds_count 4`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
+
+func TestResync(t *testing.T) {
+	got := write(t, Resync(5, 2, map[string]int{"listener": 1, "address": 2}))
+	for _, line := range []string{
+		`skrouter_resync_total{result="success"} 5`,
+		`skrouter_resync_total{result="failure"} 2`,
+		`skrouter_resync_corrections_total{type="address"} 2`,
+		`skrouter_resync_corrections_total{type="listener"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
+
+func writeCert(t *testing.T, path string, notAfter ...time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for i, expiry := range notAfter {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Unix(1500000000, 0),
+			NotAfter:     expiry,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificates(t *testing.T) {
+	dir := t.TempDir()
+	soon := time.Unix(2000000000, 0)
+	later := time.Unix(2100000000, 0)
+	writeCert(t, filepath.Join(dir, "ca.crt"), later, soon)
+	writeCert(t, filepath.Join(dir, "tls.crt"), later)
+	profiles := map[string]qdr.SslProfile{
+		"link": {Name: "link", CaCertFile: filepath.Join(dir, "ca.crt"), CertFile: filepath.Join(dir, "tls.crt")},
+		"gone": {Name: "gone", CaCertFile: filepath.Join(dir, "missing.crt")},
+	}
+	got := write(t, Certificates(certs.InspectAll(profiles, soon.Add(-48*time.Hour), 24*time.Hour)))
+	for _, line := range []string{
+		`skrouter_ssl_certificate_expiry_timestamp_seconds{file="ca",profile="link"} 2e+09`,
+		`skrouter_ssl_certificate_expiry_timestamp_seconds{file="cert",profile="link"} 2.1e+09`,
+		`skrouter_ssl_profile_state{profile="link",state="valid"} 1`,
+		`skrouter_ssl_profile_state{profile="gone",state="invalid"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, `expiry_timestamp_seconds{file="ca",profile="gone"}`) {
+		t.Errorf("unreadable certificate should have no expiry:\n%s", got)
+	}
+}
@@ -0,0 +1,143 @@
+package qdr
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type AgentPoolOptions struct {
+	// MaxSize is the maximum number of open agents, idle or in use
+	MaxSize int
+	// IdleTimeout is how long an agent may stay idle in the pool before it
+	// is closed instead of reused. Zero means no limit.
+	IdleTimeout time.Duration
+	// WaitTimeout is how long Get waits for an agent when MaxSize are in use
+	WaitTimeout time.Duration
+}
+
+func DefaultAgentPoolOptions() AgentPoolOptions {
+	return AgentPoolOptions{
+		MaxSize:     10,
+		IdleTimeout: 5 * time.Minute,
+		WaitTimeout: 30 * time.Second,
+	}
+}
+
+// AgentPool keeps agents open for reuse. An idle agent is probed with a
+// management query before it is handed out, so connections broken by a router
+// restart are replaced by new ones.
+type AgentPool struct {
+	url     string
+	config  TlsConfigRetriever
+	options AgentPoolOptions
+	idle    chan *Agent
+	// slots holds a token for each open agent, idle or in use
+	slots chan struct{}
+}
+
+func NewAgentPool(url string, config TlsConfigRetriever) *AgentPool {
+	return NewAgentPoolWithOptions(url, config, DefaultAgentPoolOptions())
+}
+
+func NewAgentPoolWithOptions(url string, config TlsConfigRetriever, options AgentPoolOptions) *AgentPool {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultAgentPoolOptions().MaxSize
+	}
+	return &AgentPool{
+		url:     url,
+		config:  config,
+		options: options,
+		idle:    make(chan *Agent, options.MaxSize),
+		slots:   make(chan struct{}, options.MaxSize),
+	}
+}
+
+// Get returns an idle agent that still answers, or connects a new one. If
+// MaxSize agents are in use, it waits for one to be returned with Put.
+func (p *AgentPool) Get() (*Agent, error) {
+	var timeout <-chan time.Time
+	if p.options.WaitTimeout > 0 {
+		timer := time.NewTimer(p.options.WaitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		// Prefer idle agents over opening new connections
+		select {
+		case a := <-p.idle:
+			if p.usable(a) {
+				return a, nil
+			}
+			p.discard(a)
+			continue
+		default:
+		}
+		select {
+		case a := <-p.idle:
+			if p.usable(a) {
+				return a, nil
+			}
+			p.discard(a)
+		case p.slots <- struct{}{}:
+			a, err := Connect(p.url, p.config)
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			return a, nil
+		case <-timeout:
+			return nil, fmt.Errorf("Timed out waiting for one of %d agents to be available", p.options.MaxSize)
+		}
+	}
+}
+
+// Put returns an agent to the pool. Closed agents are dropped.
+func (p *AgentPool) Put(a *Agent) {
+	if a == nil {
+		return
+	}
+	if a.isClosed() {
+		<-p.slots
+		return
+	}
+	a.tx = nil
+	a.idleSince = time.Now()
+	select {
+	case p.idle <- a:
+	default:
+		p.discard(a)
+	}
+}
+
+// CloseIdle closes the idle agents, e.g. once the router was restarted and
+// their connections are known to be broken.
+func (p *AgentPool) CloseIdle() {
+	for {
+		select {
+		case a := <-p.idle:
+			p.discard(a)
+		default:
+			return
+		}
+	}
+}
+
+func (p *AgentPool) usable(a *Agent) bool {
+	if a.isClosed() {
+		return false
+	}
+	if p.options.IdleTimeout > 0 && time.Since(a.idleSince) > p.options.IdleTimeout {
+		return false
+	}
+	if err := a.ping(); err != nil {
+		log.Printf("DEBUG: Discarding agent that no longer answers: %s", err)
+		return false
+	}
+	return true
+}
+
+func (p *AgentPool) discard(a *Agent) {
+	a.Close()
+	<-p.slots
+}
@@ -0,0 +1,68 @@
+package qdr
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func unreachablePool(options AgentPoolOptions) *AgentPool {
+	// Nothing listens on port 1, so connecting fails immediately
+	return NewAgentPoolWithOptions("amqp://127.0.0.1:1", nil, options)
+}
+
+func TestAgentPoolReleasesFailedConnections(t *testing.T) {
+	p := unreachablePool(AgentPoolOptions{MaxSize: 1, WaitTimeout: 50 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		if _, err := p.Get(); err == nil || strings.Contains(err.Error(), "Timed out") {
+			t.Fatalf("Get() error = %v, want connection error", err)
+		}
+	}
+}
+
+func TestAgentPoolMaxSize(t *testing.T) {
+	p := unreachablePool(AgentPoolOptions{MaxSize: 1, WaitTimeout: 50 * time.Millisecond})
+	// An agent in use holds the only slot
+	p.slots <- struct{}{}
+	if _, err := p.Get(); err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Get() error = %v, want timeout", err)
+	}
+	// Returning a closed agent frees its slot
+	p.Put(&Agent{closed: true})
+	if _, err := p.Get(); err == nil || strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Get() error = %v, want connection error", err)
+	}
+}
+
+func TestAgentPoolIdleTimeout(t *testing.T) {
+	p := unreachablePool(AgentPoolOptions{MaxSize: 1, IdleTimeout: time.Millisecond, WaitTimeout: 50 * time.Millisecond})
+	p.slots <- struct{}{}
+	idle := &Agent{}
+	p.Put(idle)
+	time.Sleep(5 * time.Millisecond)
+	// The expired agent is closed and a new connection attempted
+	if _, err := p.Get(); err == nil || strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Get() error = %v, want connection error", err)
+	}
+	if !idle.closed {
+		t.Errorf("expired idle agent was not closed")
+	}
+}
+
+func TestAgentPoolCloseIdle(t *testing.T) {
+	p := unreachablePool(AgentPoolOptions{MaxSize: 2})
+	agents := []*Agent{{}, {}}
+	for _, a := range agents {
+		p.slots <- struct{}{}
+		p.Put(a)
+	}
+	p.CloseIdle()
+	for i, a := range agents {
+		if !a.closed {
+			t.Errorf("agent %d not closed", i)
+		}
+	}
+	if len(p.slots) != 0 || len(p.idle) != 0 {
+		t.Errorf("slots = %d, idle = %d, want none", len(p.slots), len(p.idle))
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	path_ "path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/datasance/router/internal/config"
@@ -44,8 +46,16 @@ type Agent struct {
 	receiver   *amqp.Receiver
 	local      *Router
 	closed     bool
+	tx         *Transaction
+	replies    *replyDispatcher
+	// idleSince is when the agent was returned to its pool
+	idleSince time.Time
+	mu        sync.Mutex
 }
 
+// DefaultRequestTimeout applies to management requests made without a context.
+const DefaultRequestTimeout = 5 * time.Second
+
 type Router struct {
 	Id          string
 	Address     string
@@ -184,41 +194,6 @@ func (node *RouterNode) AsRouter() *Router {
 	}
 }
 
-type AgentPool struct {
-	url    string
-	config TlsConfigRetriever
-	pool   chan *Agent
-}
-
-func NewAgentPool(url string, config TlsConfigRetriever) *AgentPool {
-	return &AgentPool{
-		url:    url,
-		config: config,
-		pool:   make(chan *Agent, 10),
-	}
-}
-
-func (p *AgentPool) Get() (*Agent, error) {
-	var a *Agent
-	var err error
-	select {
-	case a = <-p.pool:
-	default:
-		a, err = Connect(p.url, p.config)
-	}
-	return a, err
-}
-
-func (p *AgentPool) Put(a *Agent) {
-	if !a.closed {
-		select {
-		case p.pool <- a:
-		default:
-			a.Close()
-		}
-	}
-}
-
 func Connect(url string, config TlsConfigRetriever) (*Agent, error) {
 	factory := ConnectionFactory{
 		url:    url,
@@ -239,16 +214,19 @@ func newAgent(factory *ConnectionFactory) (*Agent, error) {
 		amqp.LinkCredit(10),
 	)
 	if err != nil {
+		connection.Close()
 		return nil, fmt.Errorf("Failed to create receiver: %s", err)
 	}
 	sender, err := connection.session.NewSender(
 		amqp.LinkTargetAddress("$management"),
 	)
 	if err != nil {
+		connection.Close()
 		return nil, fmt.Errorf("Failed to create sender: %s", err)
 	}
 	anonymous, err := connection.session.NewSender()
 	if err != nil {
+		connection.Close()
 		return nil, fmt.Errorf("Failed to create anonymous sender: %s", err)
 	}
 	a := &Agent{
@@ -258,9 +236,11 @@ func newAgent(factory *ConnectionFactory) (*Agent, error) {
 		anonymous:  anonymous,
 		receiver:   receiver,
 	}
+	a.replies = newReplyDispatcher(acceptingReceiver{receiver})
 	a.local, err = a.GetLocalRouter()
 	if err != nil {
-		return a, fmt.Errorf("Failed to lookup local router details: %s", err)
+		a.Close()
+		return nil, fmt.Errorf("Failed to lookup local router details: %s", err)
 	}
 	return a, nil
 }
@@ -273,10 +253,30 @@ func (a *Agent) newReceiver(address string) (*amqp.Receiver, error) {
 }
 
 func (a *Agent) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
 	a.closed = true
+	if a.connection == nil {
+		return nil
+	}
 	return a.connection.Close()
 }
 
+func (a *Agent) isClosed() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.closed
+}
+
+// ping checks that the router still answers on the agent's connection.
+func (a *Agent) ping() error {
+	_, err := a.Query("io.skupper.router.router", []string{"id"})
+	return err
+}
+
 func isOk(code int) bool {
 	return code >= 200 && code < 300
 }
@@ -332,15 +332,39 @@ func GetRouterAddress(id string, edge bool) string {
 	}
 }
 
-func (a *Agent) request(operation string, typename string, name string, attributes map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-	defer cancel()
+// roundTrip sends request with a new correlation id and waits for the reply
+// with the same id.
+func (a *Agent) roundTrip(ctx context.Context, sender *amqp.Sender, request *amqp.Message) (*amqp.Message, error) {
+	id, reply, err := a.replies.register()
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	if request.Properties == nil {
+		request.Properties = &amqp.MessageProperties{}
+	}
+	request.Properties.ReplyTo = a.receiver.Address()
+	request.Properties.CorrelationID = id
+	if err := sender.Send(ctx, request); err != nil {
+		a.replies.cancel(id)
+		// A request that timed out does not mean the connection is broken
+		if ctx.Err() == nil {
+			a.Close()
+		}
+		return nil, fmt.Errorf("Could not send request: %s", err)
+	}
+	response, err := a.replies.wait(ctx, id, reply)
+	if err != nil {
+		if a.replies.broken() {
+			a.Close()
+		}
+		return nil, err
+	}
+	return response, nil
+}
 
+func (a *Agent) request(ctx context.Context, operation string, typename string, name string, attributes map[string]interface{}) error {
 	var request amqp.Message
-	var properties amqp.MessageProperties
-	properties.ReplyTo = a.receiver.Address()
-	properties.CorrelationID = uint64(1)
-	request.Properties = &properties
 	request.ApplicationProperties = make(map[string]interface{})
 	request.ApplicationProperties["operation"] = operation
 	request.ApplicationProperties["type"] = typename
@@ -349,47 +373,85 @@ func (a *Agent) request(operation string, typename string, name string, attribut
 		request.Value = attributes
 	}
 
-	if err := a.sender.Send(ctx, &request); err != nil {
-		a.Close()
-		return fmt.Errorf("Could not send request: %s", err)
-	}
-
-	response, err := a.receiver.Receive(ctx)
+	response, err := a.roundTrip(ctx, a.sender, &request)
 	if err != nil {
-		a.Close()
-		return fmt.Errorf("Failed to receive response: %s", err)
+		return &ManagementError{Operation: operation, Type: typename, Name: name, Err: err}
 	}
-	response.Accept()
-	if status, ok := AsInt(response.ApplicationProperties["statusCode"]); !ok && !isOk(status) {
-		return fmt.Errorf("Query failed with: %s", response.ApplicationProperties["statusDescription"])
-	}
-	return nil
+	return statusError(response, operation, typename, name)
+}
+
+// requestContext returns the context for a request made without one.
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), DefaultRequestTimeout)
 }
 
 func (a *Agent) Create(typename string, name string, entity recordType) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+	return a.CreateContext(ctx, typename, name, entity)
+}
+
+func (a *Agent) CreateContext(ctx context.Context, typename string, name string, entity recordType) error {
 	attributes := entity.toRecord()
 	log.Println("CREATE", typename, name, attributes)
-	return a.request("CREATE", typename, name, attributes)
+	err := a.request(ctx, "CREATE", typename, name, attributes)
+	if IsAlreadyExists(err) {
+		// Not recorded, as rolling back must not delete what was already there
+		log.Printf("DEBUG: %s %s already exists", typename, name)
+		return nil
+	}
+	if a.tx != nil {
+		a.tx.record(Operation{Operation: "CREATE", Type: typename, Name: name, Entity: entity}, err)
+	}
+	return err
 }
 
 func (a *Agent) Update(typename string, name string, entity recordType) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+	return a.UpdateContext(ctx, typename, name, entity)
+}
+
+func (a *Agent) UpdateContext(ctx context.Context, typename string, name string, entity recordType) error {
 	attributes := entity.toRecord()
 	log.Println("UPDATE", typename, name, attributes)
-	return a.request("UPDATE", typename, name, attributes)
+	err := a.request(ctx, "UPDATE", typename, name, attributes)
+	if a.tx != nil {
+		a.tx.record(Operation{Operation: "UPDATE", Type: typename, Name: name, Entity: entity}, err)
+	}
+	return err
 }
 
 func (a *Agent) Delete(typename string, name string) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+	return a.DeleteContext(ctx, typename, name)
+}
+
+func (a *Agent) DeleteContext(ctx context.Context, typename string, name string) error {
 	if name == "" {
 		return fmt.Errorf("Cannot delete entity of type %s with no name", typename)
 	}
 	log.Println("DELETE", typename, name)
-	return a.request("DELETE", typename, name, nil)
+	err := a.request(ctx, "DELETE", typename, name, nil)
+	if IsNotFound(err) {
+		log.Printf("DEBUG: %s %s already deleted", typename, name)
+		return nil
+	}
+	if a.tx != nil {
+		a.tx.record(Operation{Operation: "DELETE", Type: typename, Name: name}, err)
+	}
+	return err
 }
 
 func (a *Agent) Query(typename string, attributes []string) ([]Record, error) {
 	return a.QueryRouterNode(typename, attributes, nil)
 }
 
+func (a *Agent) QueryContext(ctx context.Context, typename string, attributes []string) ([]Record, error) {
+	return a.QueryByAgentAddressContext(ctx, typename, attributes, "")
+}
+
 func (a *Agent) QueryRouterNode(typename string, attributes []string, node *RouterNode) ([]Record, error) {
 	var address string
 	if node != nil {
@@ -449,54 +511,52 @@ func AsUint64(value interface{}) (uint64, bool) {
 }
 
 func (a *Agent) QueryByAgentAddress(typename string, attributes []string, agent string) ([]Record, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	ctx, cancel := requestContext()
 	defer cancel()
+	return a.QueryByAgentAddressContext(ctx, typename, attributes, agent)
+}
+
+func (a *Agent) QueryByAgentAddressContext(ctx context.Context, typename string, attributes []string, agent string) ([]Record, error) {
+	request, sender := a.queryRequest(Query{typename: typename, attributes: attributes, agent: agent})
+	response, err := a.roundTrip(ctx, sender, request)
+	if err != nil {
+		return nil, &ManagementError{Operation: "QUERY", Type: typename, Err: err}
+	}
+	return asRecords(response, typename)
+}
 
+// queryRequest returns the QUERY request for q and the sender to send it on.
+func (a *Agent) queryRequest(q Query) (*amqp.Message, *amqp.Sender) {
 	var request amqp.Message
-	var properties amqp.MessageProperties
-	properties.ReplyTo = a.receiver.Address()
-	properties.CorrelationID = uint64(1)
-	request.Properties = &properties
+	request.Properties = &amqp.MessageProperties{}
 	request.ApplicationProperties = make(map[string]interface{})
 	request.ApplicationProperties["operation"] = "QUERY"
-	request.ApplicationProperties["entityType"] = typename
+	request.ApplicationProperties["entityType"] = q.typename
 	var body = make(map[string]interface{})
-	body["attributeNames"] = attributes
+	body["attributeNames"] = q.attributes
 	request.Value = body
-
-	var err error
-	if agent == "" {
-		err = a.sender.Send(ctx, &request)
-	} else {
-		request.Properties.To = agent
-		err = a.anonymous.Send(ctx, &request)
-	}
-	if err != nil {
-		a.Close()
-		return nil, fmt.Errorf("Could not send request: %s", err)
+	if q.agent == "" {
+		return &request, a.sender
 	}
+	request.Properties.To = q.agent
+	return &request, a.anonymous
+}
 
-	response, err := a.receiver.Receive(ctx)
-	if err != nil {
-		a.Close()
-		return nil, fmt.Errorf("Failed to receive response: %s", err)
-	}
-	response.Accept()
-	if status, ok := AsInt(response.ApplicationProperties["statusCode"]); ok && isOk(status) {
-		if top, ok := response.Value.(map[string]interface{}); ok {
-			records := []Record{}
-			fields := stringify(top["attributeNames"].([]interface{}))
-			results := top["results"].([]interface{})
-			for _, r := range results {
-				o := r.([]interface{})
-				records = append(records, makeRecord(fields, o))
-			}
-			return records, nil
-		} else {
-			return nil, fmt.Errorf("Bad response: %s", response.Value)
+func asRecords(response *amqp.Message, typename string) ([]Record, error) {
+	if err := statusError(response, "QUERY", typename, ""); err != nil {
+		return nil, err
+	}
+	if top, ok := response.Value.(map[string]interface{}); ok {
+		records := []Record{}
+		fields := stringify(top["attributeNames"].([]interface{}))
+		results := top["results"].([]interface{})
+		for _, r := range results {
+			o := r.([]interface{})
+			records = append(records, makeRecord(fields, o))
 		}
+		return records, nil
 	} else {
-		return nil, fmt.Errorf("Query failed with: %s", response.ApplicationProperties["statusDescription"])
+		return nil, fmt.Errorf("Bad response: %s", response.Value)
 	}
 }
 
@@ -506,6 +566,19 @@ type Query struct {
 	agent      string
 }
 
+// NewQuery returns a query for the entities of the given type, sent to the
+// management agent at the given address, or the local one if it is empty.
+func NewQuery(typename string, attributes []string, agent string) Query {
+	return Query{typename: typename, attributes: attributes, agent: agent}
+}
+
+func (q Query) String() string {
+	if q.agent == "" {
+		return "QUERY " + q.typename
+	}
+	return fmt.Sprintf("QUERY %s at %s", q.typename, q.agent)
+}
+
 func queryAllAgents(typename string, agents []string) []Query {
 	queries := make([]Query, len(agents))
 	for i, a := range agents {
@@ -540,70 +613,30 @@ func queryAllAgentsForAllTypes(typenames []string, agents []string) []Query {
 	return queries
 }
 
+// BatchQuery runs the queries with the DefaultBatchOptions. The results are in
+// the order of the queries, with nil records for the queries that failed,
+// which are reported in a *BatchError.
 func (a *Agent) BatchQuery(queries []Query) ([][]Record, error) {
-	fmt.Printf("BatchQuery(%v)\n", queries)
-	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-	defer cancel()
+	return a.BatchQueryContext(context.Background(), queries)
+}
 
-	batchResults := make([][]Record, len(queries))
-	for i, q := range queries {
-		var request amqp.Message
-		var properties amqp.MessageProperties
-		properties.ReplyTo = a.receiver.Address()
-		properties.CorrelationID = uint64(i)
-		request.Properties = &properties
-		request.ApplicationProperties = make(map[string]interface{})
-		request.ApplicationProperties["operation"] = "QUERY"
-		request.ApplicationProperties["entityType"] = q.typename
-		var body = make(map[string]interface{})
-		body["attributeNames"] = q.attributes
-		request.Value = body
-
-		var err error
-		if q.agent == "" {
-			err = a.sender.Send(ctx, &request)
-		} else {
-			request.Properties.To = q.agent
-			err = a.anonymous.Send(ctx, &request)
-		}
-		if err != nil {
-			a.Close()
-			return nil, fmt.Errorf("Could not send request: %s", err)
-		}
-	}
-	errors := []string{}
-	for i := 0; i < len(queries); i++ {
-		fmt.Printf("Waiting for response %d of %d\n", (i + 1), len(queries))
-		response, err := a.receiver.Receive(ctx)
-		if err != nil {
-			a.Close()
-			return nil, fmt.Errorf("Failed to receive response: %s", err)
-		}
-		response.Accept()
-		responseIndex, ok := response.Properties.CorrelationID.(uint64)
-		if !ok {
-			errors = append(errors, fmt.Sprintf("Could not get correct correlation id from response: %#v (%T)", response.Properties.CorrelationID, response.Properties.CorrelationID))
-		} else {
-			if status, ok := AsInt(response.ApplicationProperties["statusCode"]); ok && isOk(status) {
-				if top, ok := response.Value.(map[string]interface{}); ok {
-					records := []Record{}
-					fields := stringify(top["attributeNames"].([]interface{}))
-					results := top["results"].([]interface{})
-					for _, r := range results {
-						o := r.([]interface{})
-						records = append(records, makeRecord(fields, o))
-					}
-					batchResults[responseIndex] = records
-				} else {
-					errors = append(errors, fmt.Sprintf("Bad response: %s", response.Value))
-				}
-			} else {
-				errors = append(errors, fmt.Sprintf("Query failed with: %s", response.ApplicationProperties["statusDescription"]))
+func (a *Agent) BatchQueryContext(ctx context.Context, queries []Query) ([][]Record, error) {
+	results := a.QueryPipelined(ctx, queries, DefaultBatchOptions())
+	batchResults := make([][]Record, len(results))
+	var batchErr *BatchError
+	for i, result := range results {
+		if result.Err != nil {
+			if batchErr == nil {
+				batchErr = &BatchError{}
 			}
+			batchErr.Queries = append(batchErr.Queries, queries[i])
+			batchErr.Errors = append(batchErr.Errors, result.Err)
+			continue
 		}
+		batchResults[i] = result.Records
 	}
-	if len(errors) > 0 {
-		return nil, fmt.Errorf(strings.Join(errors, ", "))
+	if batchErr != nil {
+		return batchResults, batchErr
 	}
 	return batchResults, nil
 }
@@ -621,7 +654,7 @@ func (a *Agent) GetInteriorNodes() ([]RouterNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("Interior nodes are %v\n", records)
+	log.Printf("DEBUG: Interior nodes are %v", records)
 	nodes := make([]RouterNode, len(records))
 	for i, r := range records {
 		nodes[i] = asRouterNode(r)
@@ -722,8 +755,10 @@ func (a *Agent) GetAllRouters() ([]Router, error) {
 func (a *Agent) getConnectionsForAll(agents []string) ([]Connection, error) {
 	connections := []Connection{}
 	results, err := a.BatchQuery(queryAllAgents("io.skupper.router.connection", agents))
-	if err != nil {
+	if err != nil && !isBatchError(err) {
 		return nil, err
+	} else if err != nil {
+		log.Printf("Some routers could not be queried for connections: %s", err)
 	}
 	for _, records := range results {
 		for _, r := range records {
@@ -735,10 +770,16 @@ func (a *Agent) getConnectionsForAll(agents []string) ([]Connection, error) {
 
 func (a *Agent) getSiteIds(routers []Router) error {
 	results, err := a.BatchQuery(queryAllAgents("io.skupper.router.router", getAddressesFor(routers)))
-	if err != nil {
+	if err != nil && !isBatchError(err) {
 		return err
+	} else if err != nil {
+		log.Printf("Some routers could not be queried for their site: %s", err)
 	}
 	for i, records := range results {
+		if records == nil {
+			// The query failed, the site stays unknown
+			continue
+		}
 		if len(records) == 1 {
 			routers[i].Site = GetSiteMetadata(records[0].AsString("metadata"))
 		} else {
@@ -750,8 +791,10 @@ func (a *Agent) getSiteIds(routers []Router) error {
 
 func (a *Agent) getConnectedTo(routers []Router) error {
 	results, err := a.BatchQuery(queryAllAgents("io.skupper.router.connection", getAddressesFor(routers)))
-	if err != nil {
+	if err != nil && !isBatchError(err) {
 		return err
+	} else if err != nil {
+		log.Printf("Some routers could not be queried for connections: %s", err)
 	}
 	for i, records := range results {
 		routers[i].ConnectedTo = []string{}
@@ -876,51 +919,155 @@ func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
 	return &config, nil
 }
 
+// sslProfileFromDir returns the profile for a name found under the SSL profile
+// directory, including the client cert and key if they are present.
+func sslProfileFromDir(name string) SslProfile {
+	basePath := config.GetSSLProfilePath()
+	_, err := os.Stat(path_.Join(basePath, name, "tls.crt"))
+	return ConfigureSslProfile(name, basePath, err == nil)
+}
+
+// GetLocalRouterConfig returns the entities configured on the local router
+// that are managed through the router config.
+func (a *Agent) GetLocalRouterConfig() (*RouterConfig, error) {
+	var err error
+	config := &RouterConfig{}
+	if config.SslProfiles, err = a.GetSslProfiles(); err != nil {
+		return nil, err
+	}
+	if config.Listeners, err = a.GetLocalListeners(); err != nil {
+		return nil, err
+	}
+	if config.Connectors, err = a.GetLocalConnectors(); err != nil {
+		return nil, err
+	}
+	if config.Addresses, err = a.GetLocalAddresses(); err != nil {
+		return nil, err
+	}
+	if config.LogConfig, err = a.GetLocalLogConfig(); err != nil {
+		return nil, err
+	}
+	bridges, err := a.GetLocalBridgeConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Bridges = *bridges
+	return config, nil
+}
+
+// entityWriter applies management operations to entities, as Agent does.
+type entityWriter interface {
+	Create(typename string, name string, entity recordType) error
+	Update(typename string, name string, entity recordType) error
+	Delete(typename string, name string) error
+}
+
+// updateTcpEndpoints updates the endpoints in place. An endpoint whose UPDATE
+// the router refuses, e.g. a version that does not implement it for the
+// attribute, is replaced instead.
+func updateTcpEndpoints(w entityWriter, typename string, changes []TcpEndpointChange) error {
+	for _, change := range changes {
+		err := w.Update(typename, change.Name, change.Desired)
+		if err == nil {
+			continue
+		} else if !IsUpdateRefused(err) {
+			return err
+		}
+		log.Printf("WARN: Replacing %s %s, as it could not be updated in place: %s", typename, change.Name, err)
+		if err := w.Delete(typename, change.Name); err != nil {
+			return err
+		}
+		if err := w.Create(typename, change.Name, change.Desired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *Agent) UpdateLocalBridgeConfig(changes *BridgeConfigDifference) error {
+	for _, added := range changes.AddedSslProfiles {
+		if added == "" {
+			continue
+		}
+		if err := a.CreateSslProfile(sslProfileFromDir(added)); err != nil {
+			return fmt.Errorf("Error adding SSL Profile for tcp bridges: %s", err)
+		}
+	}
 	for _, deleted := range changes.TcpConnectors.Deleted {
 		if err := a.Delete("io.skupper.router.tcpConnector", deleted); err != nil {
 			return fmt.Errorf("Error deleting tcp connectors: %s", err)
 		}
 	}
+	for _, replaced := range changes.TcpConnectors.Replaced() {
+		if err := a.Delete("io.skupper.router.tcpConnector", replaced.Name); err != nil {
+			return fmt.Errorf("Error replacing tcp connectors: %s", err)
+		}
+	}
 	for _, deleted := range changes.TcpListeners.Deleted {
 		if err := a.Delete("io.skupper.router.tcpListener", deleted); err != nil {
 			return fmt.Errorf("Error deleting tcp listeners: %s", err)
 		}
 	}
+	for _, replaced := range changes.TcpListeners.Replaced() {
+		if err := a.Delete("io.skupper.router.tcpListener", replaced.Name); err != nil {
+			return fmt.Errorf("Error replacing tcp listeners: %s", err)
+		}
+	}
+	if err := updateTcpEndpoints(a, "io.skupper.router.tcpConnector", changes.TcpConnectors.UpdatedInPlace()); err != nil {
+		return fmt.Errorf("Error updating tcp connectors: %s", err)
+	}
+	if err := updateTcpEndpoints(a, "io.skupper.router.tcpListener", changes.TcpListeners.UpdatedInPlace()); err != nil {
+		return fmt.Errorf("Error updating tcp listeners: %s", err)
+	}
 	for _, added := range changes.TcpConnectors.Added {
 		if err := a.Create("io.skupper.router.tcpConnector", added.Name, added); err != nil {
 			return fmt.Errorf("Error adding tcp connectors: %s", err)
 		}
 	}
+	for _, replaced := range changes.TcpConnectors.Replaced() {
+		if err := a.Create("io.skupper.router.tcpConnector", replaced.Name, replaced.Desired); err != nil {
+			return fmt.Errorf("Error replacing tcp connectors: %s", err)
+		}
+	}
 	for _, added := range changes.TcpListeners.Added {
 		if err := a.Create("io.skupper.router.tcpListener", added.Name, added); err != nil {
 			return fmt.Errorf("Error adding tcp listeners: %s", err)
 		}
 	}
+	for _, replaced := range changes.TcpListeners.Replaced() {
+		if err := a.Create("io.skupper.router.tcpListener", replaced.Name, replaced.Desired); err != nil {
+			return fmt.Errorf("Error replacing tcp listeners: %s", err)
+		}
+	}
+	for _, deleted := range changes.DeletedSSlProfiles {
+		if err := a.DeleteSslProfile(deleted); err != nil {
+			return fmt.Errorf("Error deleting SSL Profile for tcp bridges: %s", err)
+		}
+	}
 	return nil
 }
 
 func (a *Agent) GetBridges(routers []Router) ([]BridgeConfig, error) {
-	configs := []BridgeConfig{}
 	agents := getAddressesFor(routers)
+	queries := []Query{}
 	for _, agent := range agents {
+		queries = append(queries, queryAllTypes([]string{"io.skupper.router.tcpConnector", "io.skupper.router.tcpListener"}, agent)...)
+	}
+	results, err := a.BatchQuery(queries)
+	if err != nil && !isBatchError(err) {
+		return nil, err
+	} else if err != nil {
+		log.Printf("Some routers could not be queried for bridges: %s", err)
+	}
+	configs := []BridgeConfig{}
+	for i := range agents {
 		config := NewBridgeConfig()
-
-		results, err := a.QueryByAgentAddress("io.skupper.router.tcpConnector", []string{}, agent)
-		if err != nil {
-			return nil, err
-		}
-		for _, record := range results {
+		for _, record := range results[2*i] {
 			config.AddTcpConnector(asTcpEndpoint(record))
 		}
-		results, err = a.QueryByAgentAddress("io.skupper.router.tcpListener", []string{}, agent)
-		if err != nil {
-			return nil, err
-		}
-		for _, record := range results {
+		for _, record := range results[2*i+1] {
 			config.AddTcpListener(asTcpEndpoint(record))
 		}
-
 		configs = append(configs, config)
 	}
 	return configs, nil
@@ -958,8 +1105,10 @@ func getTcpConnectionsFromRecords(records []Record) ([]TcpConnection, error) {
 func (a *Agent) GetTcpConnections(routers []Router) ([][]TcpConnection, error) {
 	queries := queryAllAgents("io.skupper.router.tcpConnection", getAddressesFor(routers))
 	results, err := a.BatchQuery(queries)
-	if err != nil {
+	if err != nil && !isBatchError(err) {
 		return nil, err
+	} else if err != nil {
+		log.Printf("Some routers could not be queried for tcp connections: %s", err)
 	}
 	converted := [][]TcpConnection{}
 	for _, records := range results {
@@ -1096,12 +1245,17 @@ func asConnectorStatus(record Record) ConnectorStatus {
 
 func asConnector(record Record) Connector {
 	return Connector{
-		Name:           record.AsString("name"),
-		Host:           record.AsString("host"),
-		Port:           record.AsString("port"),
-		RouteContainer: record.AsBool("routeContainer"),
-		VerifyHostname: record.AsBool("verifyHostname"),
-		SslProfile:     record.AsString("sslProfile"),
+		Name:             record.AsString("name"),
+		Role:             asRole(record.AsString("role")),
+		Host:             record.AsString("host"),
+		Port:             record.AsString("port"),
+		RouteContainer:   record.AsBool("routeContainer"),
+		Cost:             int32(record.AsInt("cost")),
+		VerifyHostname:   record.AsBool("verifyHostname"),
+		SslProfile:       record.AsString("sslProfile"),
+		LinkCapacity:     int32(record.AsInt("linkCapacity")),
+		MaxFrameSize:     record.AsInt("maxFrameSize"),
+		MaxSessionFrames: record.AsInt("maxSessionFrames"),
 	}
 }
 
@@ -1164,6 +1318,17 @@ func (a *Agent) UpdateConnectorConfig(changes *ConnectorDifference) error {
 				return err
 			}
 
+			// The profile may be new alongside the connector, in which case it is created below
+			create := false
+			if sslProfile == nil {
+				profile, ok := changes.AddedSslProfiles[added.SslProfile]
+				if !ok || profile.Name == "" {
+					return fmt.Errorf("No SSL Profile with name %s found for connector %s", added.SslProfile, added.Name)
+				}
+				sslProfile = &profile
+				create = true
+			}
+
 			if sslProfile.CaCertFile != "" {
 				_, err = os.Stat(sslProfile.CaCertFile)
 				if err != nil {
@@ -1184,6 +1349,12 @@ func (a *Agent) UpdateConnectorConfig(changes *ConnectorDifference) error {
 					return err
 				}
 			}
+
+			if create {
+				if err := a.CreateSslProfile(*sslProfile); err != nil {
+					return err
+				}
+			}
 		}
 
 		if err := a.Create("io.skupper.router.connector", added.Name, added); err != nil {
@@ -1251,15 +1422,94 @@ func (a *Agent) GetLocalListeners() (map[string]Listener, error) {
 	return listeners, nil
 }
 
+func asAddress(record Record) Address {
+	return Address{
+		Name:         record.AsString("name"),
+		Prefix:       record.AsString("prefix"),
+		Pattern:      record.AsString("pattern"),
+		Distribution: record.AsString("distribution"),
+	}
+}
+
+func (a *Agent) GetLocalAddresses() (map[string]Address, error) {
+	results, err := a.Query("io.skupper.router.router.config.address", []string{})
+	if err != nil {
+		return nil, err
+	}
+	return asAddresses(results), nil
+}
+
+// asAddresses keys the addresses by entityName, as RouterConfig.Addresses is.
+// Pattern addresses have no prefix, so keying them by prefix would collide.
+func asAddresses(records []Record) map[string]Address {
+	addresses := map[string]Address{}
+	for _, record := range records {
+		address := asAddress(record)
+		addresses[address.entityName()] = address
+	}
+	return addresses
+}
+
+func (a *Agent) UpdateAddressConfig(changes *AddressDifference) error {
+	for _, deleted := range changes.Deleted {
+		if err := a.Delete("io.skupper.router.router.config.address", deleted.entityName()); err != nil {
+			return fmt.Errorf("Error deleting addresses: %s", err)
+		}
+	}
+
+	for _, added := range changes.Added {
+		if err := a.Create("io.skupper.router.router.config.address", added.entityName(), added); err != nil {
+			return fmt.Errorf("Error adding addresses: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func asLogConfig(record Record) LogConfig {
+	return LogConfig{
+		Module: record.AsString("module"),
+		Enable: record.AsString("enable"),
+	}
+}
+
+func getLogEntityName(module string) string {
+	return "log/" + module
+}
+
+func (a *Agent) GetLocalLogConfig() (map[string]LogConfig, error) {
+	results, err := a.Query("io.skupper.router.log", []string{})
+	if err != nil {
+		return nil, err
+	}
+	logConfig := map[string]LogConfig{}
+	for _, record := range results {
+		l := asLogConfig(record)
+		logConfig[l.Module] = l
+	}
+	return logConfig, nil
+}
+
+func (a *Agent) UpdateLogConfig(changes *LogConfigDifference) error {
+	for _, updated := range changes.Updated {
+		if err := a.Update("io.skupper.router.log", getLogEntityName(updated.Module), updated); err != nil {
+			return fmt.Errorf("Error updating log level for %s: %s", updated.Module, err)
+		}
+	}
+	return nil
+}
+
 func (a *Agent) Request(request *Request) (*Response, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	return a.RequestContext(ctx, request)
+}
 
+func (a *Agent) RequestContext(ctx context.Context, request *Request) (*Response, error) {
 	requestMsg := amqp.Message{
 		Properties: &amqp.MessageProperties{
 			To:      request.Address,
 			Subject: request.Type,
-			ReplyTo: a.receiver.Address(),
 		},
 		ApplicationProperties: map[string]interface{}{},
 		Value:                 nil,
@@ -1272,20 +1522,14 @@ func (a *Agent) Request(request *Request) (*Response, error) {
 	}
 	requestMsg.ApplicationProperties[VersionProperty] = request.Version
 
-	err := a.anonymous.Send(ctx, &requestMsg)
+	responseMsg, err := a.roundTrip(ctx, a.anonymous, &requestMsg)
 	if err != nil {
-		a.Close()
-		return nil, fmt.Errorf("Could not send %s request: %s", request.Type, err)
-	}
-	responseMsg, err := a.receiver.Receive(ctx)
-	if err != nil {
-		a.Close()
-		return nil, fmt.Errorf("Failed to receive response: %s", err)
+		return nil, fmt.Errorf("%s request failed: %s", request.Type, err)
 	}
-	responseMsg.Accept()
 
 	response := Response{
-		Type: responseMsg.Properties.Subject,
+		Type:       responseMsg.Properties.Subject,
+		Properties: map[string]interface{}{},
 	}
 	for k, v := range responseMsg.ApplicationProperties {
 		if k == VersionProperty {
@@ -1352,6 +1596,58 @@ func (a *Agent) ReloadSslProfile(name string) error {
 	return nil
 }
 
+func (a *Agent) UpdateSslProfile(profile SslProfile) error {
+	if err := a.Update("io.skupper.router.sslProfile", profile.Name, profile); err != nil {
+		return fmt.Errorf("Error updating SSL Profile: %s", err)
+	}
+	return nil
+}
+
+func (a *Agent) DeleteSslProfile(name string) error {
+	result, err := a.GetSslProfileByName(name)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the profile was already removed
+	if result == nil {
+		return nil
+	}
+
+	if err := a.Delete("io.skupper.router.sslProfile", name); err != nil {
+		return fmt.Errorf("Error deleting SSL Profile: %s", err)
+	}
+
+	return nil
+}
+
+// UpdateSslProfileConfig creates added profiles and updates changed ones. It
+// must be applied before the listeners and connectors that use them.
+func (a *Agent) UpdateSslProfileConfig(changes *SslProfileDifference) error {
+	for _, added := range changes.Added {
+		if err := a.CreateSslProfile(added); err != nil {
+			return err
+		}
+	}
+	for _, updated := range changes.Updated {
+		if err := a.UpdateSslProfile(updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSslProfileConfig deletes profiles that are no longer used. It must be
+// applied after the listeners and connectors that used them are removed.
+func (a *Agent) DeleteSslProfileConfig(changes *SslProfileDifference) error {
+	for _, deleted := range changes.Deleted {
+		if err := a.DeleteSslProfile(deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func ConnectedSitesInfo(selfId string, routers []Router) types.TransportConnectedSites {
 	var connectedSites types.TransportConnectedSites
 	var self *Router
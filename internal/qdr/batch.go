@@ -0,0 +1,94 @@
+package qdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BatchOptions struct {
+	// MaxInFlight limits the queries awaiting a reply at any time
+	MaxInFlight int
+	// QueryTimeout applies to each query from when it is sent, so a slow or
+	// unreachable router does not use up the time of the others
+	QueryTimeout time.Duration
+}
+
+func DefaultBatchOptions() BatchOptions {
+	return BatchOptions{
+		MaxInFlight:  32,
+		QueryTimeout: DefaultRequestTimeout,
+	}
+}
+
+// QueryResult is the outcome of one query of a batch.
+type QueryResult struct {
+	Records []Record
+	Err     error
+}
+
+// BatchError lists the queries of a batch that failed.
+type BatchError struct {
+	Queries []Query
+	Errors  []error
+}
+
+func (e *BatchError) Error() string {
+	failures := make([]string, len(e.Queries))
+	for i, q := range e.Queries {
+		failures[i] = fmt.Sprintf("%s: %s", q, e.Errors[i])
+	}
+	return fmt.Sprintf("%d queries failed: %s", len(e.Queries), strings.Join(failures, ", "))
+}
+
+func isBatchError(err error) bool {
+	var batchErr *BatchError
+	return errors.As(err, &batchErr)
+}
+
+// QueryPipelined sends the queries without waiting for the replies of the
+// previous ones, keeping up to MaxInFlight awaiting a reply. It returns a
+// result for each query, in order. A query that fails or times out does not
+// affect the others.
+func (a *Agent) QueryPipelined(ctx context.Context, queries []Query, options BatchOptions) []QueryResult {
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = DefaultBatchOptions().MaxInFlight
+	}
+	results := make([]QueryResult, len(queries))
+	inFlight := make(chan struct{}, options.MaxInFlight)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = fmt.Errorf("Query not sent: %s", ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int, q Query) {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			results[i] = a.query(ctx, q, options.QueryTimeout)
+		}(i, q)
+	}
+	wg.Wait()
+	return results
+}
+
+func (a *Agent) query(ctx context.Context, q Query, timeout time.Duration) QueryResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	request, sender := a.queryRequest(q)
+	response, err := a.roundTrip(ctx, sender, request)
+	if err != nil {
+		return QueryResult{Err: &ManagementError{Operation: "QUERY", Type: q.typename, Err: err}}
+	}
+	records, err := asRecords(response, q.typename)
+	return QueryResult{Records: records, Err: err}
+}
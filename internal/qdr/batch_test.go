@@ -0,0 +1,53 @@
+package qdr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brokenAgent returns an agent whose connection is gone, so every query fails.
+func brokenAgent(t *testing.T) *Agent {
+	t.Helper()
+	source := make(fakeReplies)
+	close(source)
+	a := &Agent{replies: newReplyDispatcher(source)}
+	deadline := time.Now().Add(time.Second)
+	for !a.replies.broken() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return a
+}
+
+func TestBatchQueryReportsFailedQueries(t *testing.T) {
+	a := brokenAgent(t)
+	queries := queryAllAgents("io.skupper.router.connection", []string{"amqp:/_topo/0/a/$management", "amqp:/_topo/0/b/$management"})
+	results, err := a.BatchQuery(queries)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("BatchQuery() error = %v, want *BatchError", err)
+	}
+	if len(results) != 2 || results[0] != nil || results[1] != nil {
+		t.Errorf("results = %v, want a nil entry per failed query", results)
+	}
+	if len(batchErr.Queries) != 2 || !strings.Contains(err.Error(), "/_topo/0/b/") {
+		t.Errorf("BatchError = %v, want both queries", err)
+	}
+}
+
+func TestQueryPipelinedCancelled(t *testing.T) {
+	a := brokenAgent(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := a.QueryPipelined(ctx, queryAllTypes([]string{"io.skupper.router.tcpListener", "io.skupper.router.tcpConnector"}, ""), BatchOptions{MaxInFlight: 1})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, result := range results {
+		if result.Err == nil {
+			t.Errorf("result %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package qdr
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// configEntityTypes maps the entity types known in a router config file to
+// the types they are unmarshalled into.
+var configEntityTypes = map[string]reflect.Type{
+	"router":       reflect.TypeOf(RouterMetadata{}),
+	"address":      reflect.TypeOf(Address{}),
+	"connector":    reflect.TypeOf(Connector{}),
+	"listener":     reflect.TypeOf(Listener{}),
+	"sslProfile":   reflect.TypeOf(SslProfile{}),
+	"log":          reflect.TypeOf(LogConfig{}),
+	"site":         reflect.TypeOf(SiteConfig{}),
+	"tcpConnector": reflect.TypeOf(TcpEndpoint{}),
+	"tcpListener":  reflect.TypeOf(TcpEndpoint{}),
+	"linkRoute":    reflect.TypeOf(LinkRoute{}),
+	"autoLink":     reflect.TypeOf(AutoLink{}),
+}
+
+// ConfigDiagnostic describes part of a router config file that is not
+// understood and so has no effect. Field is empty when the whole element is.
+type ConfigDiagnostic struct {
+	// Index is the position of the element in the config file
+	Index   int
+	Type    string
+	Field   string
+	Message string
+}
+
+func (d ConfigDiagnostic) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("element %d (%s): %s", d.Index, d.Type, d.Message)
+	}
+	return fmt.Sprintf("element %d (%s): %s %q", d.Index, d.Type, d.Message, d.Field)
+}
+
+// ConfigDiagnosticsError is returned for a router config file that is
+// rejected because of its diagnostics.
+type ConfigDiagnosticsError struct {
+	Diagnostics []ConfigDiagnostic
+}
+
+func (e *ConfigDiagnosticsError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return fmt.Sprintf("Invalid router configuration: %s", strings.Join(messages, "; "))
+}
+
+func diagnoseConfigElement(index int, entityType string, value interface{}) []ConfigDiagnostic {
+	if slices.Contains(rawEntityTypes, entityType) {
+		return nil
+	}
+	t, ok := configEntityTypes[entityType]
+	if !ok {
+		return []ConfigDiagnostic{{Index: index, Type: entityType, Message: "unknown entity type"}}
+	}
+	attributes, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	known := jsonFields(t)
+	var diagnostics []ConfigDiagnostic
+	for _, name := range slices.Sorted(maps.Keys(attributes)) {
+		if !known[name] {
+			diagnostics = append(diagnostics, ConfigDiagnostic{Index: index, Type: entityType, Field: name, Message: "unknown attribute"})
+		}
+	}
+	return diagnostics
+}
+
+// jsonFields returns the names of the JSON fields of struct type t.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
@@ -0,0 +1,135 @@
+package qdr
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+)
+
+// replySource is where a replyDispatcher receives replies from.
+type replySource interface {
+	Receive(ctx context.Context) (*amqp.Message, error)
+}
+
+// acceptingReceiver accepts each message it receives.
+type acceptingReceiver struct {
+	receiver *amqp.Receiver
+}
+
+func (r acceptingReceiver) Receive(ctx context.Context) (*amqp.Message, error) {
+	msg, err := r.receiver.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msg.Accept()
+	return msg, nil
+}
+
+// replyDispatcher receives the replies to an agent's requests and hands each
+// one to the request with the same correlation id, so requests can be made
+// concurrently and a late reply is never taken for the reply to another
+// request.
+type replyDispatcher struct {
+	source  replySource
+	mu      sync.Mutex
+	nextId  uint64
+	pending map[uint64]chan *amqp.Message
+	// err is set once receiving fails, after which no replies will arrive
+	err  error
+	done chan struct{}
+}
+
+func newReplyDispatcher(source replySource) *replyDispatcher {
+	d := &replyDispatcher{
+		source:  source,
+		pending: map[uint64]chan *amqp.Message{},
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *replyDispatcher) run() {
+	for {
+		msg, err := d.source.Receive(context.Background())
+		if err != nil {
+			d.fail(err)
+			return
+		}
+		var id uint64
+		var ok bool
+		if msg.Properties != nil {
+			id, ok = AsUint64(msg.Properties.CorrelationID)
+		}
+		d.mu.Lock()
+		reply := d.pending[id]
+		delete(d.pending, id)
+		d.mu.Unlock()
+		if !ok || reply == nil {
+			log.Printf("DEBUG: Dropping reply with unknown correlation id %v", msg.Properties)
+			continue
+		}
+		reply <- msg
+	}
+}
+
+func (d *replyDispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = fmt.Errorf("Failed to receive response: %s", err)
+	for id, reply := range d.pending {
+		close(reply)
+		delete(d.pending, id)
+	}
+	close(d.done)
+}
+
+// register returns a new correlation id and the channel its reply will be
+// delivered on.
+func (d *replyDispatcher) register() (uint64, chan *amqp.Message, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	d.nextId++
+	reply := make(chan *amqp.Message, 1)
+	d.pending[d.nextId] = reply
+	return d.nextId, reply, nil
+}
+
+func (d *replyDispatcher) cancel(id uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+}
+
+// wait returns the reply for id, or an error if ctx is done first or no more
+// replies can be received.
+func (d *replyDispatcher) wait(ctx context.Context, id uint64, reply chan *amqp.Message) (*amqp.Message, error) {
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return nil, d.err
+		}
+		return msg, nil
+	case <-ctx.Done():
+		d.cancel(id)
+		return nil, fmt.Errorf("Failed to receive response: %s", ctx.Err())
+	}
+}
+
+// broken returns true once no more replies can be received.
+func (d *replyDispatcher) broken() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,92 @@
+package qdr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+)
+
+// fakeReplies delivers the messages sent on its channel, and fails once the
+// channel is closed.
+type fakeReplies chan *amqp.Message
+
+func (f fakeReplies) Receive(ctx context.Context) (*amqp.Message, error) {
+	msg, ok := <-f
+	if !ok {
+		return nil, errors.New("connection closed")
+	}
+	return msg, nil
+}
+
+func replyTo(id uint64, value string) *amqp.Message {
+	return &amqp.Message{
+		Properties: &amqp.MessageProperties{CorrelationID: id},
+		Value:      value,
+	}
+}
+
+func TestReplyDispatcherMatchesCorrelationIds(t *testing.T) {
+	source := make(fakeReplies)
+	d := newReplyDispatcher(source)
+	defer close(source)
+
+	first, firstReply, _ := d.register()
+	second, secondReply, _ := d.register()
+	if first == second {
+		t.Fatalf("correlation ids are not unique: %d", first)
+	}
+	// Replies arrive out of order
+	source <- replyTo(second, "second")
+	source <- replyTo(first, "first")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, err := d.wait(ctx, first, firstReply); err != nil || msg.Value != "first" {
+		t.Errorf("first reply = %v, %v", msg, err)
+	}
+	if msg, err := d.wait(ctx, second, secondReply); err != nil || msg.Value != "second" {
+		t.Errorf("second reply = %v, %v", msg, err)
+	}
+}
+
+func TestReplyDispatcherDropsLateReplies(t *testing.T) {
+	source := make(fakeReplies)
+	d := newReplyDispatcher(source)
+	defer close(source)
+
+	late, lateReply, _ := d.register()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.wait(ctx, late, lateReply); err == nil {
+		t.Fatal("expected timeout")
+	}
+
+	next, nextReply, _ := d.register()
+	source <- replyTo(late, "late")
+	source <- replyTo(next, "next")
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if msg, err := d.wait(ctx2, next, nextReply); err != nil || msg.Value != "next" {
+		t.Errorf("reply = %v, %v, want next", msg, err)
+	}
+}
+
+func TestReplyDispatcherFailsPendingRequests(t *testing.T) {
+	source := make(fakeReplies)
+	d := newReplyDispatcher(source)
+
+	id, reply, _ := d.register()
+	close(source)
+	if _, err := d.wait(context.Background(), id, reply); err == nil {
+		t.Fatal("expected error once receiving fails")
+	}
+	if !d.broken() {
+		t.Errorf("broken() = false after receive failed")
+	}
+	if _, _, err := d.register(); err == nil {
+		t.Errorf("expected register to fail once broken")
+	}
+}
@@ -0,0 +1,110 @@
+package qdr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+)
+
+// ManagementError is the failure of a management operation on an entity. It
+// holds either the status the router responded with or, when no response was
+// received, the transport error in Err.
+type ManagementError struct {
+	Operation         string
+	Type              string
+	Name              string
+	StatusCode        int
+	StatusDescription string
+	Err               error
+}
+
+func (e *ManagementError) Error() string {
+	target := e.Operation + " " + e.Type
+	if e.Name != "" {
+		target += " " + e.Name
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s failed: %s", target, e.Err)
+	}
+	return fmt.Sprintf("%s failed with %d: %s", target, e.StatusCode, e.StatusDescription)
+}
+
+func (e *ManagementError) Unwrap() error {
+	return e.Err
+}
+
+func asManagementError(err error) (*ManagementError, bool) {
+	var e *ManagementError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// IsNotFound returns true if err is a management error for an entity that
+// does not exist.
+func IsNotFound(err error) bool {
+	e, ok := asManagementError(err)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsAlreadyExists returns true if err is a management error for an entity
+// that conflicts with an existing one. The router reports duplicate names as
+// a bad request, so those are recognised by their description.
+func IsAlreadyExists(err error) bool {
+	e, ok := asManagementError(err)
+	if !ok {
+		return false
+	}
+	if e.StatusCode == http.StatusConflict {
+		return true
+	}
+	description := strings.ToLower(e.StatusDescription)
+	return e.StatusCode == http.StatusBadRequest && (strings.Contains(description, "duplicate") || strings.Contains(description, "already exists"))
+}
+
+// IsBadRequest returns true if err is a management error for a request the
+// router rejected, other than one for an entity that already exists.
+func IsBadRequest(err error) bool {
+	e, ok := asManagementError(err)
+	return ok && e.StatusCode == http.StatusBadRequest && !IsAlreadyExists(err)
+}
+
+// IsUpdateRefused returns true if err is a management error for an UPDATE the
+// router does not implement for the entity or rejects as a bad request. The
+// change can still be applied by deleting the entity and creating it again.
+func IsUpdateRefused(err error) bool {
+	e, ok := asManagementError(err)
+	return ok && (e.StatusCode == http.StatusNotImplemented || IsBadRequest(err))
+}
+
+// IsTransport returns true if err is a management error for a request that
+// got no response, because it could not be sent, timed out or the
+// connection failed.
+func IsTransport(err error) bool {
+	e, ok := asManagementError(err)
+	return ok && e.Err != nil
+}
+
+// statusError returns a ManagementError if response does not have a 2xx
+// status code.
+func statusError(response *amqp.Message, operation string, typename string, name string) error {
+	status, ok := AsInt(response.ApplicationProperties["statusCode"])
+	if ok && isOk(status) {
+		return nil
+	}
+	description, _ := response.ApplicationProperties["statusDescription"].(string)
+	if !ok {
+		description = fmt.Sprintf("no status code in response (%s)", description)
+	}
+	return &ManagementError{
+		Operation:         operation,
+		Type:              typename,
+		Name:              name,
+		StatusCode:        status,
+		StatusDescription: description,
+	}
+}
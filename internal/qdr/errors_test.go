@@ -0,0 +1,74 @@
+package qdr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+)
+
+func response(status interface{}, description string) *amqp.Message {
+	return &amqp.Message{ApplicationProperties: map[string]interface{}{
+		"statusCode":        status,
+		"statusDescription": description,
+	}}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name          string
+		response      *amqp.Message
+		ok            bool
+		notFound      bool
+		alreadyExists bool
+		badRequest    bool
+	}{
+		{name: "created", response: response(int32(201), "Created"), ok: true},
+		{name: "not found", response: response(int32(404), "Not Found"), notFound: true},
+		{name: "duplicate", response: response(int32(400), "ValidationError: Duplicate value 'web' for unique attribute 'name'"), alreadyExists: true},
+		{name: "conflict", response: response(int32(409), "Conflict"), alreadyExists: true},
+		{name: "bad request", response: response(int32(400), "ValidationError: Missing required attribute 'port'"), badRequest: true},
+		{name: "server error", response: response(int32(500), "Internal Server Error")},
+		{name: "no status", response: response(nil, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := statusError(tt.response, "CREATE", "io.skupper.router.tcpListener", "web")
+			if (err == nil) != tt.ok {
+				t.Fatalf("statusError() = %v, want ok %v", err, tt.ok)
+			}
+			if IsNotFound(err) != tt.notFound || IsAlreadyExists(err) != tt.alreadyExists || IsBadRequest(err) != tt.badRequest || IsTransport(err) {
+				t.Errorf("%v: IsNotFound %v, IsAlreadyExists %v, IsBadRequest %v, IsTransport %v", err, IsNotFound(err), IsAlreadyExists(err), IsBadRequest(err), IsTransport(err))
+			}
+		})
+	}
+}
+
+func TestManagementErrorMessage(t *testing.T) {
+	err := statusError(response(int32(404), "Not Found"), "DELETE", "io.skupper.router.tcpListener", "web")
+	if want := "DELETE io.skupper.router.tcpListener web failed with 404: Not Found"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+	wrapped := fmt.Errorf("Error deleting listener: %w", err)
+	if !IsNotFound(wrapped) {
+		t.Errorf("IsNotFound(%v) = false for wrapped error", wrapped)
+	}
+}
+
+func TestRequestTransportError(t *testing.T) {
+	a := brokenAgent(t)
+	err := a.Create("io.skupper.router.tcpListener", "web", TcpEndpoint{Name: "web"})
+	if !IsTransport(err) {
+		t.Fatalf("Create() = %v, want transport error", err)
+	}
+	if IsNotFound(err) || IsAlreadyExists(err) || IsBadRequest(err) {
+		t.Errorf("transport error %v classified by status", err)
+	}
+	if !strings.HasPrefix(err.Error(), "CREATE io.skupper.router.tcpListener web failed: ") {
+		t.Errorf("Error() = %q", err)
+	}
+	if _, err := a.Query("io.skupper.router.connection", nil); !IsTransport(err) {
+		t.Errorf("Query() = %v, want transport error", err)
+	}
+}
@@ -0,0 +1,279 @@
+package qdr
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+)
+
+const (
+	LinkDirectionIn  = "in"
+	LinkDirectionOut = "out"
+)
+
+// LinkRoute routes links for addresses matching a prefix or pattern to a
+// container, usually an external broker, reached through a connector.
+type LinkRoute struct {
+	Name              string `json:"name,omitempty"`
+	Prefix            string `json:"prefix,omitempty"`
+	Pattern           string `json:"pattern,omitempty"`
+	Direction         string `json:"direction,omitempty"`
+	ContainerId       string `json:"containerId,omitempty"`
+	Connection        string `json:"connection,omitempty"`
+	AddExternalPrefix string `json:"addExternalPrefix,omitempty"`
+	DelExternalPrefix string `json:"delExternalPrefix,omitempty"`
+}
+
+func (l LinkRoute) toRecord() Record {
+	result := make(map[string]any)
+	if l.Name != "" {
+		result["name"] = l.Name
+	}
+	if l.Prefix != "" {
+		result["prefix"] = l.Prefix
+	}
+	if l.Pattern != "" {
+		result["pattern"] = l.Pattern
+	}
+	if l.Direction != "" {
+		result["direction"] = l.Direction
+	}
+	if l.ContainerId != "" {
+		result["containerId"] = l.ContainerId
+	}
+	if l.Connection != "" {
+		result["connection"] = l.Connection
+	}
+	if l.AddExternalPrefix != "" {
+		result["addExternalPrefix"] = l.AddExternalPrefix
+	}
+	if l.DelExternalPrefix != "" {
+		result["delExternalPrefix"] = l.DelExternalPrefix
+	}
+	return result
+}
+
+// Equivalent returns true if the link route on the router, a, matches the
+// desired one, b. The router reports both prefix and pattern, so only the one
+// that is configured is compared.
+func (a LinkRoute) Equivalent(b LinkRoute) bool {
+	if b.Prefix != "" && a.Prefix != b.Prefix {
+		return false
+	}
+	if b.Pattern != "" && a.Pattern != b.Pattern {
+		return false
+	}
+	return a.Direction == b.Direction &&
+		a.ContainerId == b.ContainerId &&
+		a.Connection == b.Connection &&
+		a.AddExternalPrefix == b.AddExternalPrefix &&
+		a.DelExternalPrefix == b.DelExternalPrefix
+}
+
+// AutoLink is a link the router attaches on its own to a container, usually an
+// external broker, so messages for an address flow to or from it.
+type AutoLink struct {
+	Name            string `json:"name,omitempty"`
+	Address         string `json:"address,omitempty"`
+	Direction       string `json:"direction,omitempty"`
+	Phase           int    `json:"phase,omitempty"`
+	ContainerId     string `json:"containerId,omitempty"`
+	Connection      string `json:"connection,omitempty"`
+	ExternalAddress string `json:"externalAddress,omitempty"`
+}
+
+func (l AutoLink) toRecord() Record {
+	result := make(map[string]any)
+	if l.Name != "" {
+		result["name"] = l.Name
+	}
+	if l.Address != "" {
+		result["address"] = l.Address
+	}
+	if l.Direction != "" {
+		result["direction"] = l.Direction
+	}
+	if l.Phase != 0 {
+		result["phase"] = l.Phase
+	}
+	if l.ContainerId != "" {
+		result["containerId"] = l.ContainerId
+	}
+	if l.Connection != "" {
+		result["connection"] = l.Connection
+	}
+	if l.ExternalAddress != "" {
+		result["externalAddress"] = l.ExternalAddress
+	}
+	return result
+}
+
+// Equivalent returns true if the auto-link on the router, a, matches the
+// desired one, b. The router reports the phase it defaulted to when none is
+// configured, so the phase is only compared when it is set.
+func (a AutoLink) Equivalent(b AutoLink) bool {
+	if b.Phase != 0 {
+		return a == b
+	}
+	a.Phase = 0
+	return a == b
+}
+
+// checkEntityName returns an error if an entity kept in entities by name has
+// none, or the name of one parsed before, as it would replace it.
+func checkEntityName[T any](entityType string, name string, entities map[string]T) error {
+	if name == "" {
+		return fmt.Errorf("Invalid %s element: name must be set", entityType)
+	}
+	if _, ok := entities[name]; ok {
+		return fmt.Errorf("Invalid %s element: duplicate name %q", entityType, name)
+	}
+	return nil
+}
+
+func asLinkRoute(record Record) LinkRoute {
+	return LinkRoute{
+		Name:              record.AsString("name"),
+		Prefix:            record.AsString("prefix"),
+		Pattern:           record.AsString("pattern"),
+		Direction:         record.AsString("direction"),
+		ContainerId:       record.AsString("containerId"),
+		Connection:        record.AsString("connection"),
+		AddExternalPrefix: record.AsString("addExternalPrefix"),
+		DelExternalPrefix: record.AsString("delExternalPrefix"),
+	}
+}
+
+func asAutoLink(record Record) AutoLink {
+	phase, _ := AsInt(record["phase"])
+	return AutoLink{
+		Name:            record.AsString("name"),
+		Address:         record.AsString("address"),
+		Direction:       record.AsString("direction"),
+		Phase:           phase,
+		ContainerId:     record.AsString("containerId"),
+		Connection:      record.AsString("connection"),
+		ExternalAddress: record.AsString("externalAddress"),
+	}
+}
+
+type LinkRouteDifference struct {
+	Deleted []string
+	Added   []LinkRoute
+}
+
+func (a *LinkRouteDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
+// LinkRoutesDifference compares link routes keyed by name. A changed link
+// route is deleted and added again, as the router does not allow link routes
+// to be updated.
+func LinkRoutesDifference(actual map[string]LinkRoute, desired map[string]LinkRoute) *LinkRouteDifference {
+	result := LinkRouteDifference{}
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		desiredValue := desired[name]
+		if actualValue, ok := actual[name]; ok {
+			if actualValue.Equivalent(desiredValue) {
+				continue
+			}
+			log.Printf("Link route definition does not match. Have %v want %v", actualValue, desiredValue)
+			result.Deleted = append(result.Deleted, name)
+		}
+		result.Added = append(result.Added, desiredValue)
+	}
+	for _, name := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := desired[name]; !ok {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+	return &result
+}
+
+type AutoLinkDifference struct {
+	Deleted []string
+	Added   []AutoLink
+}
+
+func (a *AutoLinkDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
+// AutoLinksDifference compares auto-links keyed by name. A changed auto-link
+// is deleted and added again, as the router does not allow auto-links to be
+// updated.
+func AutoLinksDifference(actual map[string]AutoLink, desired map[string]AutoLink) *AutoLinkDifference {
+	result := AutoLinkDifference{}
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		desiredValue := desired[name]
+		if actualValue, ok := actual[name]; ok {
+			if actualValue.Equivalent(desiredValue) {
+				continue
+			}
+			log.Printf("Auto-link definition does not match. Have %v want %v", actualValue, desiredValue)
+			result.Deleted = append(result.Deleted, name)
+		}
+		result.Added = append(result.Added, desiredValue)
+	}
+	for _, name := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := desired[name]; !ok {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+	return &result
+}
+
+func (a *Agent) GetLocalLinkRoutes() (map[string]LinkRoute, error) {
+	results, err := a.Query("io.skupper.router.router.config.linkRoute", []string{})
+	if err != nil {
+		return nil, err
+	}
+	linkRoutes := map[string]LinkRoute{}
+	for _, record := range results {
+		l := asLinkRoute(record)
+		linkRoutes[l.Name] = l
+	}
+	return linkRoutes, nil
+}
+
+func (a *Agent) GetLocalAutoLinks() (map[string]AutoLink, error) {
+	results, err := a.Query("io.skupper.router.router.config.autoLink", []string{})
+	if err != nil {
+		return nil, err
+	}
+	autoLinks := map[string]AutoLink{}
+	for _, record := range results {
+		l := asAutoLink(record)
+		autoLinks[l.Name] = l
+	}
+	return autoLinks, nil
+}
+
+func (a *Agent) UpdateLinkRouteConfig(changes *LinkRouteDifference) error {
+	for _, deleted := range changes.Deleted {
+		if err := a.Delete("io.skupper.router.router.config.linkRoute", deleted); err != nil {
+			return fmt.Errorf("Error deleting link routes: %s", err)
+		}
+	}
+	for _, added := range changes.Added {
+		if err := a.Create("io.skupper.router.router.config.linkRoute", added.Name, added); err != nil {
+			return fmt.Errorf("Error adding link routes: %s", err)
+		}
+	}
+	return nil
+}
+
+func (a *Agent) UpdateAutoLinkConfig(changes *AutoLinkDifference) error {
+	for _, deleted := range changes.Deleted {
+		if err := a.Delete("io.skupper.router.router.config.autoLink", deleted); err != nil {
+			return fmt.Errorf("Error deleting auto-links: %s", err)
+		}
+	}
+	for _, added := range changes.Added {
+		if err := a.Create("io.skupper.router.router.config.autoLink", added.Name, added); err != nil {
+			return fmt.Errorf("Error adding auto-links: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package qdr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkRoutesDifference(t *testing.T) {
+	actual := map[string]LinkRoute{
+		// The router reports the pattern derived from the configured prefix
+		"queues": {Name: "queues", Prefix: "queue.", Pattern: "queue.#", Direction: LinkDirectionIn, Connection: "broker"},
+		"topics": {Name: "topics", Prefix: "topic.", Direction: LinkDirectionIn, Connection: "broker"},
+		"old":    {Name: "old", Prefix: "old.", Direction: LinkDirectionOut},
+	}
+	desired := map[string]LinkRoute{
+		"queues": {Name: "queues", Prefix: "queue.", Direction: LinkDirectionIn, Connection: "broker"},
+		"topics": {Name: "topics", Prefix: "topic.", Direction: LinkDirectionOut, Connection: "broker"},
+		"new":    {Name: "new", Pattern: "new.*", Direction: LinkDirectionIn},
+	}
+	changes := LinkRoutesDifference(actual, desired)
+	if strings.Join(changes.Deleted, ",") != "topics,old" {
+		t.Errorf("Deleted = %v, want topics and old", changes.Deleted)
+	}
+	if len(changes.Added) != 2 || changes.Added[0].Name != "new" || changes.Added[1].Name != "topics" {
+		t.Errorf("Added = %v, want new and topics", changes.Added)
+	}
+	if !LinkRoutesDifference(desired, desired).Empty() {
+		t.Errorf("expected no changes for identical link routes")
+	}
+}
+
+func TestAutoLinksDifference(t *testing.T) {
+	actual := map[string]AutoLink{
+		"orders-in": {Name: "orders-in", Address: "orders", Direction: LinkDirectionIn, Connection: "broker"},
+		"stale":     {Name: "stale", Address: "stale", Direction: LinkDirectionOut},
+	}
+	desired := map[string]AutoLink{
+		"orders-in": {Name: "orders-in", Address: "orders", Direction: LinkDirectionIn, Connection: "broker", ExternalAddress: "queue.orders"},
+	}
+	changes := AutoLinksDifference(actual, desired)
+	if strings.Join(changes.Deleted, ",") != "orders-in,stale" {
+		t.Errorf("Deleted = %v, want orders-in and stale", changes.Deleted)
+	}
+	if len(changes.Added) != 1 || changes.Added[0].ExternalAddress != "queue.orders" {
+		t.Errorf("Added = %v, want updated orders-in", changes.Added)
+	}
+
+	// The router reports the phase it defaulted to when none is configured
+	actual = map[string]AutoLink{
+		"orders-in":  {Name: "orders-in", Address: "orders", Direction: LinkDirectionIn, Phase: 1},
+		"orders-out": {Name: "orders-out", Address: "orders", Direction: LinkDirectionOut, Phase: 0},
+	}
+	desired = map[string]AutoLink{
+		"orders-in":  {Name: "orders-in", Address: "orders", Direction: LinkDirectionIn},
+		"orders-out": {Name: "orders-out", Address: "orders", Direction: LinkDirectionOut, Phase: 1},
+	}
+	changes = AutoLinksDifference(actual, desired)
+	if strings.Join(changes.Deleted, ",") != "orders-out" || len(changes.Added) != 1 || changes.Added[0].Phase != 1 {
+		t.Errorf("changes = %+v, want only orders-out, whose configured phase differs", changes)
+	}
+}
+
+func TestLinksRoundTripAndValidate(t *testing.T) {
+	config := `[
+		["router", {"id": "router-a", "mode": "interior"}],
+		["linkRoute", {"name": "queues", "prefix": "queue.", "direction": "in", "connection": "broker"}],
+		["autoLink", {"name": "orders", "address": "orders", "direction": "out", "phase": 1, "connection": "broker"}]
+	]`
+	result, diagnostics, err := ParseRouterConfig(config)
+	if err != nil || len(diagnostics) != 0 {
+		t.Fatalf("ParseRouterConfig() = %v, %v", diagnostics, err)
+	}
+	if result.LinkRoutes["queues"].Prefix != "queue." || result.AutoLinks["orders"].Phase != 1 {
+		t.Errorf("LinkRoutes = %v, AutoLinks = %v", result.LinkRoutes, result.AutoLinks)
+	}
+	data, _ := MarshalRouterConfig(result)
+	if !RouterConfigEquals(data, config) {
+		t.Errorf("round trip changed config:\n%s", data)
+	}
+	if err := result.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if record := result.AutoLinks["orders"].toRecord(); record["phase"] != 1 || record["externalAddress"] != nil {
+		t.Errorf("toRecord() = %v", record)
+	}
+
+	for _, config := range []string{
+		`[["linkRoute", {"prefix": "a.", "direction": "in"}]]`,
+		`[["autoLink", {"name": "x", "address": "x", "direction": "in"}], ["autoLink", {"name": "x", "address": "y", "direction": "in"}]]`,
+	} {
+		if _, _, err := ParseRouterConfig(config); err == nil {
+			t.Errorf("ParseRouterConfig(%s) should fail for a missing or duplicate name", config)
+		}
+	}
+
+	result.LinkRoutes["both"] = LinkRoute{Name: "both", Prefix: "a.", Pattern: "a.#", Direction: LinkDirectionIn}
+	result.AutoLinks["sideways"] = AutoLink{Name: "sideways", Address: "x", Direction: "sideways"}
+	result.AutoLinks[""] = AutoLink{Address: "x", Direction: LinkDirectionIn}
+	err = result.Validate()
+	if err == nil || !strings.Contains(err.Error(), "linkRoute both: exactly one of prefix and pattern") || !strings.Contains(err.Error(), "autoLink sideways: direction") || !strings.Contains(err.Error(), `autoLink "": name must be set`) {
+		t.Errorf("Validate() = %v, want link route and auto-link violations", err)
+	}
+}
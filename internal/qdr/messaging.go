@@ -3,16 +3,129 @@ package qdr
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
 
 	amqp "github.com/interconnectedcloud/go-amqp"
 
 	"github.com/datasance/router/internal/messaging"
+	"github.com/datasance/router/internal/utils/tlscfg"
 )
 
 type TlsConfigRetriever interface {
 	GetTlsConfig() (*tls.Config, error)
 }
 
+// SaslConfigRetriever may be implemented by a TlsConfigRetriever to choose
+// the SASL mechanism. EXTERNAL is used otherwise.
+type SaslConfigRetriever interface {
+	GetSaslConfig() SaslConfig
+}
+
+const (
+	SaslAnonymous = "ANONYMOUS"
+	SaslPlain     = "PLAIN"
+	SaslExternal  = "EXTERNAL"
+)
+
+type SaslConfig struct {
+	// Mechanism is one of ANONYMOUS, PLAIN or EXTERNAL, or empty for no SASL
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+func (s SaslConfig) connOption() (amqp.ConnOption, error) {
+	switch strings.ToUpper(s.Mechanism) {
+	case "":
+		return nil, nil
+	case SaslAnonymous:
+		return amqp.ConnSASLAnonymous(), nil
+	case SaslPlain:
+		if s.Username == "" {
+			return nil, fmt.Errorf("SASL PLAIN requires a username")
+		}
+		return amqp.ConnSASLPlain(s.Username, s.Password), nil
+	case SaslExternal:
+		return amqp.ConnSASLExternal(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported SASL mechanism %q", s.Mechanism)
+	}
+}
+
+// ManagementConfig is a TlsConfigRetriever for connecting to the router's
+// management listener with TLS and SASL.
+type ManagementConfig struct {
+	// SslProfile provides the CA to verify the router with and, for mutual
+	// TLS, the client certificate and key. TLS is not used if it is nil.
+	SslProfile *SslProfile
+	Sasl       SaslConfig
+	// sslProfileName names the profile under SSL_PROFILE_PATH that is looked
+	// up again on each dial, in place of SslProfile
+	sslProfileName string
+}
+
+// NewManagementConfig returns the config for connecting with the certificates
+// of the named profile under SSL_PROFILE_PATH, if any, and the given SASL.
+// The profile's files are resolved on each dial, so certificates rotated or
+// added after startup are used by new connections.
+func NewManagementConfig(sslProfile string, sasl SaslConfig) *ManagementConfig {
+	return &ManagementConfig{Sasl: sasl, sslProfileName: sslProfile}
+}
+
+func (m *ManagementConfig) profile() *SslProfile {
+	if m.sslProfileName != "" {
+		profile := sslProfileFromDir(m.sslProfileName)
+		return &profile
+	}
+	return m.SslProfile
+}
+
+func (m *ManagementConfig) GetTlsConfig() (*tls.Config, error) {
+	profile := m.profile()
+	if profile == nil {
+		return nil, nil
+	}
+	config := tlscfg.Default()
+	if profile.CaCertFile != "" {
+		ca, err := os.ReadFile(profile.CaCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA certificate: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No CA certificate found in %s", profile.CaCertFile)
+		}
+	}
+	if profile.CertFile != "" && profile.PrivateKeyFile != "" {
+		certFile, keyFile := profile.CertFile, profile.PrivateKeyFile
+		// Loaded when the router asks for it, so a connection made with this
+		// config presents the certificate on disk at the time
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("Could not load client certificate: %s", err)
+			}
+			return &cert, nil
+		}
+	}
+	return config, nil
+}
+
+// GetSaslConfig returns the configured SASL. Without a mechanism, EXTERNAL is
+// used when the profile has a client certificate.
+func (m *ManagementConfig) GetSaslConfig() SaslConfig {
+	sasl := m.Sasl
+	if sasl.Mechanism == "" {
+		if profile := m.profile(); profile != nil && profile.CertFile != "" {
+			sasl.Mechanism = SaslExternal
+		}
+	}
+	return sasl
+}
+
 type ConnectionFactory struct {
 	url    string
 	config TlsConfigRetriever
@@ -21,13 +134,27 @@ type ConnectionFactory struct {
 func (f *ConnectionFactory) Connect() (messaging.Connection, error) {
 	if f.config == nil {
 		return dial(f.url, amqp.ConnMaxFrameSize(4294967295))
-	} else {
-		tlsConfig, err := f.config.GetTlsConfig()
-		if err != nil {
-			return nil, err
-		}
-		return dial(f.url, amqp.ConnSASLExternal(), amqp.ConnMaxFrameSize(4294967295), amqp.ConnTLSConfig(tlsConfig))
 	}
+	opts := []amqp.ConnOption{amqp.ConnMaxFrameSize(4294967295)}
+	tlsConfig, err := f.config.GetTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, amqp.ConnTLSConfig(tlsConfig))
+	}
+	sasl := SaslConfig{Mechanism: SaslExternal}
+	if retriever, ok := f.config.(SaslConfigRetriever); ok {
+		sasl = retriever.GetSaslConfig()
+	}
+	saslOpt, err := sasl.connOption()
+	if err != nil {
+		return nil, err
+	}
+	if saslOpt != nil {
+		opts = append(opts, saslOpt)
+	}
+	return dial(f.url, opts...)
 }
 
 func dial(addr string, opts ...amqp.ConnOption) (*AmqpConnection, error) {
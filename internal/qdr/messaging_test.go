@@ -0,0 +1,140 @@
+package qdr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/resources/types"
+)
+
+func TestSaslConfig(t *testing.T) {
+	for _, mechanism := range []string{SaslAnonymous, SaslExternal, "plain"} {
+		opt, err := SaslConfig{Mechanism: mechanism, Username: "admin"}.connOption()
+		if err != nil || opt == nil {
+			t.Errorf("%s: got %v, %v", mechanism, opt, err)
+		}
+	}
+	if opt, err := (SaslConfig{}).connOption(); err != nil || opt != nil {
+		t.Errorf("no mechanism: got %v, %v, want no SASL", opt, err)
+	}
+	if _, err := (SaslConfig{Mechanism: SaslPlain}).connOption(); err == nil {
+		t.Errorf("expected error for PLAIN without username")
+	}
+	if _, err := (SaslConfig{Mechanism: "GSSAPI"}).connOption(); err == nil {
+		t.Errorf("expected error for unsupported mechanism")
+	}
+}
+
+func writeTestCertificate(t *testing.T, dir string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "management"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	files := map[string][]byte{
+		"ca.crt":  cert,
+		"tls.crt": cert,
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestManagementConfig(t *testing.T) {
+	if tlsConfig, err := (&ManagementConfig{}).GetTlsConfig(); err != nil || tlsConfig != nil {
+		t.Errorf("no profile: got %v, %v, want no TLS", tlsConfig, err)
+	}
+
+	dir := t.TempDir()
+	writeTestCertificate(t, dir)
+	profile := SslProfile{
+		Name:           "management",
+		CaCertFile:     filepath.Join(dir, "ca.crt"),
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		PrivateKeyFile: filepath.Join(dir, "tls.key"),
+	}
+	tlsConfig, err := (&ManagementConfig{SslProfile: &profile}).GetTlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.RootCAs == nil || tlsConfig.GetClientCertificate == nil {
+		t.Fatalf("expected CA and client certificate, got %+v", tlsConfig)
+	}
+	if cert, err := tlsConfig.GetClientCertificate(nil); err != nil || len(cert.Certificate) != 1 {
+		t.Errorf("client certificate = %v, %v", cert, err)
+	}
+
+	profile.CaCertFile = filepath.Join(dir, "missing.crt")
+	if _, err := (&ManagementConfig{SslProfile: &profile}).GetTlsConfig(); err == nil {
+		t.Errorf("expected error for missing CA certificate")
+	}
+}
+
+func TestManagementConfigResolvesProfileOnEachDial(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv(types.EnvSSLProfilePath, base)
+	dir := filepath.Join(base, "management")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCertificate(t, dir)
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if err := os.Rename(filepath.Join(dir, name), filepath.Join(base, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManagementConfig("management", SaslConfig{})
+	tlsConfig, err := m.GetTlsConfig()
+	if err != nil || tlsConfig.GetClientCertificate != nil || m.GetSaslConfig().Mechanism != "" {
+		t.Fatalf("CA only: got %+v, %v, SASL %v, want no client certificate", tlsConfig, err, m.GetSaslConfig())
+	}
+
+	// A client certificate added later is used by the next dial
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if err := os.Rename(filepath.Join(base, name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tlsConfig, err = m.GetTlsConfig()
+	if err != nil || tlsConfig.GetClientCertificate == nil {
+		t.Fatalf("with client certificate: got %+v, %v", tlsConfig, err)
+	}
+	if _, err := tlsConfig.GetClientCertificate(nil); err != nil {
+		t.Errorf("client certificate: %v", err)
+	}
+	if m.GetSaslConfig().Mechanism != SaslExternal {
+		t.Errorf("SASL = %v, want EXTERNAL with a client certificate", m.GetSaslConfig())
+	}
+	if sasl := NewManagementConfig("management", SaslConfig{Mechanism: SaslPlain}).GetSaslConfig(); sasl.Mechanism != SaslPlain {
+		t.Errorf("SASL = %v, want the configured mechanism", sasl)
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net"
+	"net/url"
 	path_ "path"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/datasance/router/internal/resources/types"
+	"github.com/datasance/router/internal/utils"
 )
 
 type RouterConfig struct {
@@ -22,6 +26,11 @@ type RouterConfig struct {
 	LogConfig   map[string]LogConfig
 	SiteConfig  *SiteConfig
 	Bridges     BridgeConfig
+	LinkRoutes  map[string]LinkRoute
+	AutoLinks   map[string]AutoLink
+	// RawEntities are the entities of types the model does not know, kept
+	// so they are not lost when the config is written back
+	RawEntities []RawEntity
 }
 
 type RouterConfigHandler interface {
@@ -49,6 +58,8 @@ func InitialConfig(id string, siteId string, version string, edge bool, helloAge
 		Listeners:   map[string]Listener{},
 		Connectors:  map[string]Connector{},
 		LogConfig:   map[string]LogConfig{},
+		LinkRoutes:  map[string]LinkRoute{},
+		AutoLinks:   map[string]AutoLink{},
 		Bridges: BridgeConfig{
 			TcpListeners:  map[string]TcpEndpoint{},
 			TcpConnectors: map[string]TcpEndpoint{},
@@ -200,8 +211,42 @@ func (r *RouterConfig) UnreferencedSslProfiles() map[string]SslProfile {
 	return results
 }
 
+// ReferencesSslProfile returns true if any listener, connector or bridge uses
+// the named SSL profile.
+func (r *RouterConfig) ReferencesSslProfile(name string) bool {
+	return len(r.SslProfileUsers(name)) > 0
+}
+
+// SslProfileUsers returns the listeners, connectors and bridges that use the
+// named SSL profile, e.g. "listener amqps", sorted.
+func (r *RouterConfig) SslProfileUsers(name string) []string {
+	var users []string
+	for _, o := range r.Listeners {
+		if o.SslProfile == name {
+			users = append(users, "listener "+o.Name)
+		}
+	}
+	for _, o := range r.Connectors {
+		if o.SslProfile == name {
+			users = append(users, "connector "+o.Name)
+		}
+	}
+	for _, o := range r.Bridges.TcpListeners {
+		if o.SslProfile == name {
+			users = append(users, "tcpListener "+o.Name)
+		}
+	}
+	for _, o := range r.Bridges.TcpConnectors {
+		if o.SslProfile == name {
+			users = append(users, "tcpConnector "+o.Name)
+		}
+	}
+	slices.Sort(users)
+	return users
+}
+
 func (r *RouterConfig) AddAddress(a Address) {
-	r.Addresses[a.Prefix] = a
+	r.Addresses[a.entityName()] = a
 }
 
 func (r *RouterConfig) AddTcpConnector(e TcpEndpoint) {
@@ -373,6 +418,11 @@ type SslProfile struct {
 	CertFile       string `json:"certFile,omitempty"`
 	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
 	CaCertFile     string `json:"caCertFile,omitempty"`
+	// Cert, Key and CaCert are inline PEM content, which is written to files
+	// by StageSslProfile before the profile is applied
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+	CaCert string `json:"caCert,omitempty"`
 }
 
 func (p SslProfile) toRecord() Record {
@@ -397,6 +447,13 @@ type LogConfig struct {
 	Enable string `json:"enable"`
 }
 
+func (l LogConfig) toRecord() Record {
+	return map[string]any{
+		"module": l.Module,
+		"enable": l.Enable,
+	}
+}
+
 type Listener struct {
 	Name             string `json:"name,omitempty" yaml:"name,omitempty"`
 	Role             Role   `json:"role,omitempty" yaml:"role,omitempty"`
@@ -499,6 +556,12 @@ func (connector Connector) toRecord() Record {
 	if len(connector.SslProfile) > 0 {
 		record["sslProfile"] = connector.SslProfile
 	}
+	if connector.LinkCapacity > 0 {
+		record["linkCapacity"] = connector.LinkCapacity
+	}
+	if connector.RouteContainer {
+		record["routeContainer"] = connector.RouteContainer
+	}
 	if connector.MaxFrameSize > 0 {
 		record["maxFrameSize"] = connector.MaxFrameSize
 	}
@@ -525,10 +588,56 @@ const (
 )
 
 type Address struct {
+	Name         string `json:"name,omitempty"`
 	Prefix       string `json:"prefix,omitempty"`
+	Pattern      string `json:"pattern,omitempty"`
 	Distribution string `json:"distribution,omitempty"`
 }
 
+func (a Address) toRecord() Record {
+	result := make(map[string]any)
+	if a.Name != "" {
+		result["name"] = a.Name
+	}
+	if a.Prefix != "" {
+		result["prefix"] = a.Prefix
+	}
+	if a.Pattern != "" {
+		result["pattern"] = a.Pattern
+	}
+	if a.Distribution != "" {
+		result["distribution"] = a.Distribution
+	}
+	return result
+}
+
+// entityName returns the name used to identify the address over management.
+// Addresses loaded from the config file are usually unnamed, in which case
+// the prefix, or else the pattern, is used when creating them.
+func (a Address) entityName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if a.Prefix != "" {
+		return a.Prefix
+	}
+	return a.Pattern
+}
+
+func equivalentDistribution(a string, b string) bool {
+	if a == "" {
+		a = string(DistributionBalanced)
+	}
+	if b == "" {
+		b = string(DistributionBalanced)
+	}
+	return a == b
+}
+
+func (desired Address) Equivalent(actual Address) bool {
+	return desired.Prefix == actual.Prefix && desired.Pattern == actual.Pattern && equivalentDistribution(desired.Distribution, actual.Distribution)
+}
+
 type TcpEndpoint struct {
 	Name           string `json:"name,omitempty"`
 	Host           string `json:"host,omitempty"`
@@ -590,6 +699,8 @@ func convert(from interface{}, to interface{}) error {
 	return nil
 }
 
+// RouterConfigEquals returns true if the two JSON configs configure the same
+// entities, regardless of their order.
 func RouterConfigEquals(actual, desired string) bool {
 	actualConfig, err := UnmarshalRouterConfig(actual)
 	if err != nil {
@@ -599,10 +710,58 @@ func RouterConfigEquals(actual, desired string) bool {
 	if err != nil {
 		return false
 	}
-	return reflect.DeepEqual(actualConfig, desiredConfig)
+	return actualConfig.Equals(desiredConfig)
+}
+
+// Equals returns true if c and other configure the same entities. Nil and
+// empty maps are treated alike.
+func (c RouterConfig) Equals(other RouterConfig) bool {
+	return reflect.DeepEqual(c.normalized(), other.normalized())
+}
+
+func (c RouterConfig) normalized() RouterConfig {
+	if c.SslProfiles == nil {
+		c.SslProfiles = map[string]SslProfile{}
+	}
+	if c.Listeners == nil {
+		c.Listeners = map[string]Listener{}
+	}
+	if c.Connectors == nil {
+		c.Connectors = map[string]Connector{}
+	}
+	if c.Addresses == nil {
+		c.Addresses = map[string]Address{}
+	}
+	if c.LogConfig == nil {
+		c.LogConfig = map[string]LogConfig{}
+	}
+	if c.Bridges.TcpListeners == nil {
+		c.Bridges.TcpListeners = map[string]TcpEndpoint{}
+	}
+	if c.Bridges.TcpConnectors == nil {
+		c.Bridges.TcpConnectors = map[string]TcpEndpoint{}
+	}
+	if c.LinkRoutes == nil {
+		c.LinkRoutes = map[string]LinkRoute{}
+	}
+	if c.AutoLinks == nil {
+		c.AutoLinks = map[string]AutoLink{}
+	}
+	c.RawEntities = sortRawEntities(c.RawEntities)
+	return c
 }
 
 func UnmarshalRouterConfig(config string) (RouterConfig, error) {
+	result, _, err := ParseRouterConfig(config)
+	return result, err
+}
+
+// ParseRouterConfig unmarshals config like UnmarshalRouterConfig, and also
+// returns a diagnostic for each element of an unknown type and each unknown
+// attribute, which are otherwise ignored. Elements of the skrouterd types the
+// model does not know are kept as RawEntities instead.
+func ParseRouterConfig(config string) (RouterConfig, []ConfigDiagnostic, error) {
+	var diagnostics []ConfigDiagnostic
 	result := RouterConfig{
 		Metadata:    RouterMetadata{},
 		Addresses:   map[string]Address{},
@@ -610,6 +769,8 @@ func UnmarshalRouterConfig(config string) (RouterConfig, error) {
 		Listeners:   map[string]Listener{},
 		Connectors:  map[string]Connector{},
 		LogConfig:   map[string]LogConfig{},
+		LinkRoutes:  map[string]LinkRoute{},
+		AutoLinks:   map[string]AutoLink{},
 		Bridges: BridgeConfig{
 			TcpListeners:  map[string]TcpEndpoint{},
 			TcpConnectors: map[string]TcpEndpoint{},
@@ -618,153 +779,157 @@ func UnmarshalRouterConfig(config string) (RouterConfig, error) {
 	var obj interface{}
 	err := json.Unmarshal([]byte(config), &obj)
 	if err != nil {
-		return result, err
+		return result, nil, err
 	}
 	elements, ok := obj.([]interface{})
 	if !ok {
-		return result, fmt.Errorf("Invalid JSON for router configuration, expected array at top level got %#v", obj)
+		return result, nil, fmt.Errorf("Invalid JSON for router configuration, expected array at top level got %#v", obj)
 	}
-	for _, e := range elements {
+	for i, e := range elements {
 		element, ok := e.([]interface{})
 		if !ok || len(element) != 2 {
-			return result, fmt.Errorf("Invalid JSON for router configuration, expected array with type and value got %#v", e)
+			return result, nil, fmt.Errorf("Invalid JSON for router configuration, expected array with type and value got %#v", e)
 		}
 		entityType, ok := element[0].(string)
 		if !ok {
-			return result, fmt.Errorf("Invalid JSON for router configuration, expected entity type as string got %#v", element[0])
+			return result, nil, fmt.Errorf("Invalid JSON for router configuration, expected entity type as string got %#v", element[0])
 		}
+		diagnostics = append(diagnostics, diagnoseConfigElement(i, entityType, element[1])...)
 		switch entityType {
 		case "router":
 			metadata := RouterMetadata{}
 			err = convert(element[1], &metadata)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Metadata = metadata
 		case "address":
 			address := Address{}
 			err = convert(element[1], &address)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
-			result.Addresses[address.Prefix] = address
+			result.Addresses[address.entityName()] = address
 		case "connector":
 			connector := Connector{}
 			err = convert(element[1], &connector)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Connectors[connector.Name] = connector
 		case "listener":
 			listener := Listener{}
 			err = convert(element[1], &listener)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Listeners[listener.Name] = listener
 		case "sslProfile":
 			sslProfile := SslProfile{}
 			err = convert(element[1], &sslProfile)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.SslProfiles[sslProfile.Name] = sslProfile
 		case "log":
 			logConfig := LogConfig{}
 			err = convert(element[1], &logConfig)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.LogConfig[logConfig.Module] = logConfig
 		case "site":
 			siteConfig := &SiteConfig{}
 			err = convert(element[1], siteConfig)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.SiteConfig = siteConfig
 		case "tcpConnector":
 			connector := TcpEndpoint{}
 			err = convert(element[1], &connector)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Bridges.TcpConnectors[connector.Name] = connector
 		case "tcpListener":
 			listener := TcpEndpoint{}
 			err = convert(element[1], &listener)
 			if err != nil {
-				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Bridges.TcpListeners[listener.Name] = listener
+		case "linkRoute":
+			linkRoute := LinkRoute{}
+			err = convert(element[1], &linkRoute)
+			if err != nil {
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+			}
+			if err := checkEntityName(entityType, linkRoute.Name, result.LinkRoutes); err != nil {
+				return result, nil, err
+			}
+			result.LinkRoutes[linkRoute.Name] = linkRoute
+		case "autoLink":
+			autoLink := AutoLink{}
+			err = convert(element[1], &autoLink)
+			if err != nil {
+				return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+			}
+			if err := checkEntityName(entityType, autoLink.Name, result.AutoLinks); err != nil {
+				return result, nil, err
+			}
+			result.AutoLinks[autoLink.Name] = autoLink
 		default:
+			// Other unknown types are dropped, and reported by diagnoseConfigElement
+			if slices.Contains(rawEntityTypes, entityType) {
+				attributes, ok := element[1].(map[string]interface{})
+				if !ok {
+					return result, nil, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+				}
+				result.RawEntities = append(result.RawEntities, RawEntity{Type: entityType, Attributes: attributes})
+			}
 		}
 	}
-	return result, nil
+	return result, diagnostics, nil
 }
 
+// MarshalRouterConfig returns the canonical JSON for config. Entities are
+// written by type in a fixed order and sorted by key within each type, so the
+// same config always marshals to the same bytes.
 func MarshalRouterConfig(config RouterConfig) (string, error) {
-	elements := [][]interface{}{}
-	tuple := []interface{}{
-		"router",
-		config.Metadata,
-	}
-	elements = append(elements, tuple)
-	for _, e := range config.SslProfiles {
-		tuple := []interface{}{
-			"sslProfile",
-			e,
-		}
-		elements = append(elements, tuple)
+	elements := [][]interface{}{{"router", config.Metadata}}
+	for _, key := range slices.Sorted(maps.Keys(config.SslProfiles)) {
+		elements = append(elements, []interface{}{"sslProfile", config.SslProfiles[key]})
 	}
-	for _, e := range config.Connectors {
-		tuple := []interface{}{
-			"connector",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.Connectors)) {
+		elements = append(elements, []interface{}{"connector", config.Connectors[key]})
 	}
-	for _, e := range config.Listeners {
-		tuple := []interface{}{
-			"listener",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.Listeners)) {
+		elements = append(elements, []interface{}{"listener", config.Listeners[key]})
 	}
-	for _, e := range config.Addresses {
-		tuple := []interface{}{
-			"address",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.Addresses)) {
+		elements = append(elements, []interface{}{"address", config.Addresses[key]})
 	}
-	for _, e := range config.Bridges.TcpConnectors {
-		tuple := []interface{}{
-			"tcpConnector",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.LinkRoutes)) {
+		elements = append(elements, []interface{}{"linkRoute", config.LinkRoutes[key]})
 	}
-	for _, e := range config.Bridges.TcpListeners {
-		tuple := []interface{}{
-			"tcpListener",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.AutoLinks)) {
+		elements = append(elements, []interface{}{"autoLink", config.AutoLinks[key]})
 	}
-	for _, e := range config.LogConfig {
-		tuple := []interface{}{
-			"log",
-			e,
-		}
-		elements = append(elements, tuple)
+	for _, key := range slices.Sorted(maps.Keys(config.Bridges.TcpConnectors)) {
+		elements = append(elements, []interface{}{"tcpConnector", config.Bridges.TcpConnectors[key]})
+	}
+	for _, key := range slices.Sorted(maps.Keys(config.Bridges.TcpListeners)) {
+		elements = append(elements, []interface{}{"tcpListener", config.Bridges.TcpListeners[key]})
+	}
+	for _, key := range slices.Sorted(maps.Keys(config.LogConfig)) {
+		elements = append(elements, []interface{}{"log", config.LogConfig[key]})
+	}
+	for _, e := range sortRawEntities(config.RawEntities) {
+		elements = append(elements, []interface{}{e.Type, e.Attributes})
 	}
 	if config.SiteConfig != nil {
-		tuple := []interface{}{
-			"site",
-			*config.SiteConfig,
-		}
-		elements = append(elements, tuple)
+		elements = append(elements, []interface{}{"site", *config.SiteConfig})
 	}
 	data, err := json.MarshalIndent(elements, "", "    ")
 	if err != nil {
@@ -815,9 +980,35 @@ type ConnectorDifference struct {
 	AddedSslProfiles map[string]SslProfile
 }
 
+// UpdateStrategy describes how a modified entity is applied to the router.
+type UpdateStrategy string
+
+const (
+	// UpdateInPlace applies the change with a management UPDATE, keeping the
+	// entity (and for listeners, the bound port and active flows) in place
+	UpdateInPlace UpdateStrategy = "update"
+	// UpdateReplace deletes the entity and creates it again, which closes
+	// active flows
+	UpdateReplace UpdateStrategy = "replace"
+)
+
+// tcpEndpointUpdatableFields are the tcpListener/tcpConnector attributes the
+// router accepts in an UPDATE. Changing any other attribute (e.g. host, port,
+// address or sslProfile) requires the entity to be replaced.
+var tcpEndpointUpdatableFields = []string{"siteId", "processId", "verifyHostname"}
+
+type TcpEndpointChange struct {
+	Name     string
+	Actual   TcpEndpoint
+	Desired  TcpEndpoint
+	Fields   []string
+	Strategy UpdateStrategy
+}
+
 type TcpEndpointDifference struct {
 	Deleted []string
 	Added   []TcpEndpoint
+	Updated []TcpEndpointChange
 }
 
 type BridgeConfigDifference struct {
@@ -854,12 +1045,45 @@ func (a TcpEndpoint) equivalentVerifyHostname(b TcpEndpoint) bool {
 	return *a.VerifyHostname == *b.VerifyHostname
 }
 
+// ChangedFields returns the names of the attributes that differ between the
+// two endpoints.
+func (a TcpEndpoint) ChangedFields(b TcpEndpoint) []string {
+	fields := []string{}
+	if !equivalentHost(a.Host, b.Host) {
+		fields = append(fields, "host")
+	}
+	if a.Port != b.Port {
+		fields = append(fields, "port")
+	}
+	if a.Address != b.Address {
+		fields = append(fields, "address")
+	}
+	if a.SiteId != b.SiteId {
+		fields = append(fields, "siteId")
+	}
+	if a.ProcessID != b.ProcessID {
+		fields = append(fields, "processId")
+	}
+	if a.SslProfile != b.SslProfile {
+		fields = append(fields, "sslProfile")
+	}
+	if !a.equivalentVerifyHostname(b) {
+		fields = append(fields, "verifyHostname")
+	}
+	return fields
+}
+
 func (a TcpEndpoint) Equivalent(b TcpEndpoint) bool {
-	if !equivalentHost(a.Host, b.Host) || a.Port != b.Port || a.Address != b.Address ||
-		a.SiteId != b.SiteId || a.ProcessID != b.ProcessID || !a.equivalentVerifyHostname(b) {
-		return false
+	return len(a.ChangedFields(b)) == 0
+}
+
+func getUpdateStrategy(fields []string, updatable []string) UpdateStrategy {
+	for _, field := range fields {
+		if !utils.StringSliceContains(updatable, field) {
+			return UpdateReplace
+		}
 	}
-	return true
+	return UpdateInPlace
 }
 
 func (a TcpEndpointMap) Difference(b TcpEndpointMap) TcpEndpointDifference {
@@ -868,9 +1092,14 @@ func (a TcpEndpointMap) Difference(b TcpEndpointMap) TcpEndpointDifference {
 		v2, ok := a[key]
 		if !ok {
 			result.Added = append(result.Added, v1)
-		} else if !v1.Equivalent(v2) {
-			result.Deleted = append(result.Deleted, v1.Name)
-			result.Added = append(result.Added, v1)
+		} else if fields := v2.ChangedFields(v1); len(fields) > 0 {
+			result.Updated = append(result.Updated, TcpEndpointChange{
+				Name:     v1.Name,
+				Actual:   v2,
+				Desired:  v1,
+				Fields:   fields,
+				Strategy: getUpdateStrategy(fields, tcpEndpointUpdatableFields),
+			})
 		}
 	}
 	for key, v1 := range a {
@@ -943,7 +1172,27 @@ func isGeneratedBySkupper(name string) bool {
 }
 
 func (a *TcpEndpointDifference) Empty() bool {
-	return len(a.Deleted) == 0 && len(a.Added) == 0
+	return len(a.Deleted) == 0 && len(a.Added) == 0 && len(a.Updated) == 0
+}
+
+// Replaced returns the modified endpoints that have to be deleted and created again.
+func (a *TcpEndpointDifference) Replaced() []TcpEndpointChange {
+	return a.withStrategy(UpdateReplace)
+}
+
+// UpdatedInPlace returns the modified endpoints that can be updated in place.
+func (a *TcpEndpointDifference) UpdatedInPlace() []TcpEndpointChange {
+	return a.withStrategy(UpdateInPlace)
+}
+
+func (a *TcpEndpointDifference) withStrategy(strategy UpdateStrategy) []TcpEndpointChange {
+	changes := []TcpEndpointChange{}
+	for _, change := range a.Updated {
+		if change.Strategy == strategy {
+			changes = append(changes, change)
+		}
+	}
+	return changes
 }
 
 func (a *BridgeConfigDifference) Empty() bool {
@@ -951,18 +1200,49 @@ func (a *BridgeConfigDifference) Empty() bool {
 }
 
 func (a *BridgeConfigDifference) Print() {
-	log.Printf("TcpConnectors added=%v, deleted=%v", a.TcpConnectors.Added, a.TcpConnectors.Deleted)
-	log.Printf("TcpListeners added=%v, deleted=%v", a.TcpListeners.Added, a.TcpListeners.Deleted)
+	log.Printf("TcpConnectors added=%v, deleted=%v, updated=%v", a.TcpConnectors.Added, a.TcpConnectors.Deleted, a.TcpConnectors.Updated)
+	log.Printf("TcpListeners added=%v, deleted=%v, updated=%v", a.TcpListeners.Added, a.TcpListeners.Deleted, a.TcpListeners.Updated)
 	log.Printf("SslProfiles added=%v, deleted=%v", a.AddedSslProfiles, a.DeletedSSlProfiles)
 }
 
+func equivalentRole(desired Role, actual Role) bool {
+	if desired == RoleDefault {
+		return actual == RoleDefault || actual == RoleNormal
+	}
+	return desired == actual
+}
+
+func (desired Connector) Equivalent(actual Connector) bool {
+	return desired.Name == actual.Name &&
+		equivalentRole(desired.Role, actual.Role) &&
+		desired.Host == actual.Host &&
+		desired.Port == actual.Port &&
+		desired.RouteContainer == actual.RouteContainer &&
+		desired.SslProfile == actual.SslProfile &&
+		(desired.Cost == 0 || desired.Cost == actual.Cost) &&
+		(desired.MaxFrameSize == 0 || desired.MaxFrameSize == actual.MaxFrameSize) &&
+		(desired.MaxSessionFrames == 0 || desired.MaxSessionFrames == actual.MaxSessionFrames) &&
+		(desired.LinkCapacity == 0 || desired.LinkCapacity == actual.LinkCapacity)
+	//Skip check for VerifyHostname as it is never sent over management
+	//and the router defaults it to true.
+}
+
 func ConnectorsDifference(actual map[string]Connector, desired *RouterConfig, ignorePrefix *string) *ConnectorDifference {
 	result := ConnectorDifference{}
 	result.AddedSslProfiles = make(map[string]SslProfile)
 	for key, v1 := range desired.Connectors {
-		_, ok := actual[key]
+		v2, ok := actual[key]
 		if !ok {
 			result.Added = append(result.Added, v1)
+		} else if !v1.Equivalent(v2) {
+			log.Printf("Connector definition does not match. Have %v want %v", v2, v1)
+			// handle change as delete then add, so it also works over management protocol
+			result.Deleted = append(result.Deleted, v2)
+			result.Added = append(result.Added, v1)
+		} else {
+			continue
+		}
+		if v1.SslProfile != "" {
 			result.AddedSslProfiles[v1.SslProfile] = desired.SslProfiles[v1.SslProfile]
 		}
 	}
@@ -992,8 +1272,8 @@ type ListenerDifference struct {
 
 func (desired Listener) Equivalent(actual Listener) bool {
 	return desired.Name == actual.Name &&
-		desired.Role == actual.Role &&
-		desired.Host == actual.Host &&
+		equivalentRole(desired.Role, actual.Role) &&
+		equivalentHost(desired.Host, actual.Host) &&
 		desired.Port == actual.Port &&
 		desired.RouteContainer == actual.RouteContainer &&
 		desired.Http == actual.Http &&
@@ -1010,11 +1290,52 @@ func (desired Listener) Equivalent(actual Listener) bool {
 	//this method is required at present.
 }
 
-func ListenersDifference(actual map[string]Listener, desired map[string]Listener) *ListenerDifference {
+func isLoopback(host string) bool {
+	return host == "localhost" || net.ParseIP(host).IsLoopback()
+}
+
+// ManagementListeners returns the names of the listeners that may accept the
+// management connection to managementUrl: those on its port bound to its host,
+// to loopback when it is a loopback host, or to every address.
+func ManagementListeners(listeners map[string]Listener, managementUrl string) []string {
+	u, err := url.Parse(managementUrl)
+	if err != nil {
+		return nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = strconv.Itoa(int(types.AmqpDefaultPort))
+		if u.Scheme == "amqps" {
+			port = strconv.Itoa(int(types.AmqpsDefaultPort))
+		}
+	}
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(listeners)) {
+		listener := listeners[name]
+		if strconv.Itoa(int(listener.Port)) != port {
+			continue
+		}
+		if equivalentHost(listener.Host, "") || listener.Host == u.Hostname() ||
+			(isLoopback(listener.Host) && isLoopback(u.Hostname())) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ListenersDifference compares listeners keyed by name. A changed listener is
+// deleted and added again. Listeners named in keep, such as the ones returned
+// by ManagementListeners, are neither deleted nor replaced, as that would drop
+// the connection applying the change.
+func ListenersDifference(actual map[string]Listener, desired map[string]Listener, keep ...string) *ListenerDifference {
 	result := ListenerDifference{}
 	for key, desiredValue := range desired {
 		if actualValue, ok := actual[key]; ok {
 			if !desiredValue.Equivalent(actualValue) {
+				if slices.Contains(keep, key) {
+					log.Printf("WARN: Not replacing listener %s, the management connection depends on it. Have %v want %v", key, actualValue, desiredValue)
+					continue
+				}
 				log.Printf("Listener definition does not match. Have %v want %v", actualValue, desiredValue)
 				// handle change as delete then add, so it also works over management protocol
 				result.Deleted = append(result.Deleted, desiredValue)
@@ -1026,6 +1347,10 @@ func ListenersDifference(actual map[string]Listener, desired map[string]Listener
 	}
 	for key, value := range actual {
 		if _, ok := desired[key]; !ok {
+			if slices.Contains(keep, key) {
+				log.Printf("WARN: Not deleting listener %s, the management connection depends on it", key)
+				continue
+			}
 			result.Deleted = append(result.Deleted, value)
 		}
 	}
@@ -1036,6 +1361,99 @@ func (a *ListenerDifference) Empty() bool {
 	return len(a.Deleted) == 0 && len(a.Added) == 0
 }
 
+type SslProfileDifference struct {
+	Added   []SslProfile
+	Updated []SslProfile
+	Deleted []string
+}
+
+// SslProfilesDifference compares the SSL profiles of the router with the
+// desired configuration. Profiles whose file paths changed are updated in
+// place. Profiles that are neither desired nor referenced by any desired
+// listener, connector or bridge are deleted.
+func SslProfilesDifference(actual map[string]SslProfile, desired *RouterConfig) *SslProfileDifference {
+	result := SslProfileDifference{}
+	for name, desiredValue := range desired.SslProfiles {
+		if actualValue, ok := actual[name]; !ok {
+			result.Added = append(result.Added, desiredValue)
+		} else if actualValue != desiredValue {
+			log.Printf("SSL Profile definition does not match. Have %v want %v", actualValue, desiredValue)
+			result.Updated = append(result.Updated, desiredValue)
+		}
+	}
+	for name := range actual {
+		if _, ok := desired.SslProfiles[name]; ok {
+			continue
+		}
+		if !desired.ReferencesSslProfile(name) {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+	return &result
+}
+
+func (a *SslProfileDifference) Empty() bool {
+	return len(a.Added) == 0 && len(a.Updated) == 0 && len(a.Deleted) == 0
+}
+
+type AddressDifference struct {
+	Deleted []Address
+	Added   []Address
+}
+
+// AddressesDifference compares addresses keyed by entityName. The router names
+// the addresses created unnamed from its config file itself, e.g.
+// router.config.address/0, so an actual address not declared under its name
+// matches a desired one with the same prefix and pattern. A changed
+// distribution is handled as delete then add, as the router does not allow
+// address entities to be updated.
+func AddressesDifference(actual map[string]Address, desired map[string]Address) *AddressDifference {
+	result := AddressDifference{}
+	matched := map[string]bool{}
+	for _, key := range slices.Sorted(maps.Keys(desired)) {
+		desiredValue := desired[key]
+		actualKey, ok := key, false
+		if _, ok = actual[key]; !ok {
+			actualKey, ok = unnamedAddress(actual, desired, matched, desiredValue)
+		}
+		if !ok {
+			result.Added = append(result.Added, desiredValue)
+			continue
+		}
+		matched[actualKey] = true
+		if actualValue := actual[actualKey]; !desiredValue.Equivalent(actualValue) {
+			log.Printf("Address definition does not match. Have %v want %v", actualValue, desiredValue)
+			result.Deleted = append(result.Deleted, actualValue)
+			result.Added = append(result.Added, desiredValue)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := desired[key]; !ok && !matched[key] {
+			result.Deleted = append(result.Deleted, actual[key])
+		}
+	}
+	return &result
+}
+
+// unnamedAddress returns the key of an actual address that is not declared
+// under its own name and has the prefix and pattern of a.
+func unnamedAddress(actual map[string]Address, desired map[string]Address, matched map[string]bool, a Address) (string, bool) {
+	for _, key := range slices.Sorted(maps.Keys(actual)) {
+		other := actual[key]
+		if _, declared := desired[key]; declared || matched[key] {
+			continue
+		}
+		if other.Prefix == a.Prefix && other.Pattern == a.Pattern {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (a *AddressDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
 // func GetRouterConfigForHeadlessProxy(definition types.ServiceInterface, siteId string, version string, namespace string, profilePath string) (string, error) {
 // 	config := InitialConfig("${HOSTNAME}-"+siteId, siteId, version, true, 3)
 // 	// add edge-connector
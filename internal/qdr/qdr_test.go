@@ -0,0 +1,450 @@
+package qdr
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListenersDifference(t *testing.T) {
+	actual := map[string]Listener{
+		"amqp": {
+			Name: "amqp",
+			Role: RoleNormal,
+			Host: "localhost",
+			Port: 5672,
+		},
+		"interior-listener": {
+			Name: "interior-listener",
+			Role: RoleInterRouter,
+			Port: 55671,
+			Cost: 1,
+		},
+	}
+	desired := map[string]Listener{
+		"amqp": {
+			Name: "amqp",
+			Host: "localhost",
+			Port: 5672,
+		},
+		"edge-listener": {
+			Name: "edge-listener",
+			Role: RoleEdge,
+			Port: 45671,
+		},
+	}
+	changes := ListenersDifference(actual, desired)
+	if len(changes.Added) != 1 || changes.Added[0].Name != "edge-listener" {
+		t.Errorf("Added = %v, want [edge-listener]", changes.Added)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0].Name != "interior-listener" {
+		t.Errorf("Deleted = %v, want [interior-listener]", changes.Deleted)
+	}
+}
+
+func TestListenersDifferenceKeepsManagementListener(t *testing.T) {
+	actual := map[string]Listener{
+		"amqp":     {Name: "amqp", Role: RoleNormal, Host: "localhost", Port: 5672},
+		"public":   {Name: "public", Role: RoleNormal, Port: 5671, SslProfile: "public"},
+		"loopback": {Name: "loopback", Role: RoleNormal, Host: "127.0.0.1", Port: 5673},
+	}
+	if got := ManagementListeners(actual, "amqp://127.0.0.1"); len(got) != 1 || got[0] != "amqp" {
+		t.Errorf("ManagementListeners(amqp) = %v, want [amqp]", got)
+	}
+	if got := ManagementListeners(actual, "amqps://router.example.com"); len(got) != 1 || got[0] != "public" {
+		t.Errorf("ManagementListeners(amqps) = %v, want [public]", got)
+	}
+	if got := ManagementListeners(actual, "amqp://router.example.com:5673"); len(got) != 0 {
+		t.Errorf("ManagementListeners(other host) = %v, want none", got)
+	}
+
+	// The management listener is left alone whether it was removed or changed
+	keep := ManagementListeners(actual, "amqp://localhost:5672")
+	changes := ListenersDifference(actual, map[string]Listener{}, keep...)
+	if len(changes.Deleted) != 2 || slices.ContainsFunc(changes.Deleted, func(l Listener) bool { return l.Name == "amqp" }) {
+		t.Errorf("Deleted = %v, want all but amqp", changes.Deleted)
+	}
+	changes = ListenersDifference(actual, map[string]Listener{
+		"amqp":     {Name: "amqp", Host: "localhost", Port: 5672, SaslMechanisms: "PLAIN"},
+		"public":   actual["public"],
+		"loopback": actual["loopback"],
+	}, keep...)
+	if !changes.Empty() {
+		t.Errorf("changes = %+v, want the management listener kept as it is", changes)
+	}
+}
+
+func TestConnectorsDifference(t *testing.T) {
+	actual := map[string]Connector{
+		"uplink": {
+			Name: "uplink",
+			Role: RoleEdge,
+			Host: "interior-a",
+			Port: "45671",
+			Cost: 1,
+		},
+		"stale": {
+			Name: "stale",
+			Role: RoleInterRouter,
+			Host: "interior-b",
+			Port: "55671",
+		},
+	}
+	desired := &RouterConfig{
+		SslProfiles: map[string]SslProfile{
+			"link-profile": {Name: "link-profile", CaCertFile: "/certs/link-profile/ca.crt"},
+		},
+		Connectors: map[string]Connector{
+			"uplink": {
+				Name:       "uplink",
+				Role:       RoleEdge,
+				Host:       "interior-c",
+				Port:       "45671",
+				SslProfile: "link-profile",
+			},
+			"link": {
+				Name: "link",
+				Role: RoleInterRouter,
+				Host: "interior-d",
+				Port: "55671",
+			},
+		},
+	}
+	changes := ConnectorsDifference(actual, desired, nil)
+	added := map[string]bool{}
+	for _, c := range changes.Added {
+		added[c.Name] = true
+	}
+	if len(added) != 2 || !added["uplink"] || !added["link"] {
+		t.Errorf("Added = %v, want [uplink link]", changes.Added)
+	}
+	deleted := map[string]Connector{}
+	for _, c := range changes.Deleted {
+		deleted[c.Name] = c
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Deleted = %v, want [uplink stale]", changes.Deleted)
+	}
+	if deleted["uplink"].Host != "interior-a" {
+		t.Errorf("modified connector should be deleted as the actual definition, got %v", deleted["uplink"])
+	}
+	if p, ok := changes.AddedSslProfiles["link-profile"]; !ok || p.CaCertFile != "/certs/link-profile/ca.crt" {
+		t.Errorf("AddedSslProfiles = %v, want link-profile", changes.AddedSslProfiles)
+	}
+
+	// Unchanged connectors produce no difference
+	unchanged := ConnectorsDifference(map[string]Connector{
+		"link": {Name: "link", Role: RoleInterRouter, Host: "interior-d", Port: "55671", Cost: 1},
+	}, &RouterConfig{Connectors: map[string]Connector{
+		"link": {Name: "link", Role: RoleInterRouter, Host: "interior-d", Port: "55671"},
+	}}, nil)
+	if !unchanged.Empty() {
+		t.Errorf("expected no changes, got %+v", unchanged)
+	}
+}
+
+func TestAddressesDifference(t *testing.T) {
+	// Created unnamed from the config file, so named by the router
+	actual := asAddresses([]Record{
+		{"name": "router.config.address/0", "prefix": "mc", "distribution": DistributionMulticast},
+		{"name": "router.config.address/1", "prefix": "sensor", "distribution": string(DistributionBalanced)},
+		{"name": "router.config.address/2", "prefix": "old", "distribution": DistributionClosest},
+	})
+	desired := map[string]Address{
+		"mc":     {Prefix: "mc", Distribution: DistributionMulticast},
+		"sensor": {Prefix: "sensor", Distribution: DistributionMulticast},
+		"new":    {Prefix: "new"},
+	}
+	changes := AddressesDifference(actual, desired)
+	deleted := map[string]bool{}
+	for _, a := range changes.Deleted {
+		deleted[a.entityName()] = true
+	}
+	if len(deleted) != 2 || !deleted["router.config.address/1"] || !deleted["router.config.address/2"] {
+		t.Errorf("Deleted = %v, want sensor and old by their router names", changes.Deleted)
+	}
+	added := map[string]Address{}
+	for _, a := range changes.Added {
+		added[a.entityName()] = a
+	}
+	if len(added) != 2 || added["sensor"].Distribution != DistributionMulticast {
+		t.Errorf("Added = %v, want sensor (multicast) and new", changes.Added)
+	}
+	if _, ok := added["new"]; !ok {
+		t.Errorf("Added = %v, want new", changes.Added)
+	}
+
+	// An unset distribution is equivalent to balanced
+	if !AddressesDifference(map[string]Address{"a": {Prefix: "a", Distribution: "balanced"}}, map[string]Address{"a": {Prefix: "a"}}).Empty() {
+		t.Errorf("expected unset distribution to match balanced")
+	}
+}
+
+func TestAddressesDifferencePatterns(t *testing.T) {
+	// Pattern addresses have no prefix, so must not collide in the router state
+	actual := asAddresses([]Record{
+		{"name": "sensors", "pattern": "sensors/#", "distribution": DistributionMulticast},
+		{"name": "router.config.address/1", "pattern": "*/events", "distribution": string(DistributionBalanced)},
+	})
+	if len(actual) != 2 {
+		t.Fatalf("asAddresses() = %v, want both pattern addresses", actual)
+	}
+	desired := map[string]Address{}
+	config := RouterConfig{Addresses: desired}
+	config.AddAddress(Address{Name: "sensors", Pattern: "sensors/#", Distribution: DistributionMulticast})
+	config.AddAddress(Address{Pattern: "*/events"})
+	if len(desired) != 2 {
+		t.Fatalf("Addresses = %v, want both pattern addresses", desired)
+	}
+	if changes := AddressesDifference(actual, desired); !changes.Empty() {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	config.AddAddress(Address{Pattern: "*/alerts", Distribution: DistributionClosest})
+	delete(desired, "*/events")
+	changes := AddressesDifference(actual, desired)
+	if len(changes.Added) != 1 || changes.Added[0].Pattern != "*/alerts" {
+		t.Errorf("Added = %v, want */alerts", changes.Added)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0].entityName() != "router.config.address/1" {
+		t.Errorf("Deleted = %v, want */events by its router name", changes.Deleted)
+	}
+}
+
+func TestSslProfilesDifference(t *testing.T) {
+	actual := map[string]SslProfile{
+		"kept":       {Name: "kept", CaCertFile: "/certs/kept/ca.crt"},
+		"moved":      {Name: "moved", CaCertFile: "/certs/moved/ca.crt"},
+		"unused":     {Name: "unused", CaCertFile: "/certs/unused/ca.crt"},
+		"referenced": {Name: "referenced", CaCertFile: "/certs/referenced/ca.crt"},
+	}
+	desired := &RouterConfig{
+		SslProfiles: map[string]SslProfile{
+			"kept":  {Name: "kept", CaCertFile: "/certs/kept/ca.crt"},
+			"moved": {Name: "moved", CaCertFile: "/other/moved/ca.crt"},
+			"new":   {Name: "new", CaCertFile: "/certs/new/ca.crt"},
+		},
+		Connectors: map[string]Connector{
+			"uplink": {Name: "uplink", SslProfile: "referenced"},
+		},
+	}
+	changes := SslProfilesDifference(actual, desired)
+	if len(changes.Added) != 1 || changes.Added[0].Name != "new" {
+		t.Errorf("Added = %v, want [new]", changes.Added)
+	}
+	if len(changes.Updated) != 1 || changes.Updated[0].CaCertFile != "/other/moved/ca.crt" {
+		t.Errorf("Updated = %v, want [moved]", changes.Updated)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "unused" {
+		t.Errorf("Deleted = %v, want [unused]", changes.Deleted)
+	}
+}
+
+func TestSslProfileUsers(t *testing.T) {
+	c := &RouterConfig{
+		Listeners:  map[string]Listener{"amqps": {Name: "amqps", SslProfile: "tls"}},
+		Connectors: map[string]Connector{"uplink": {Name: "uplink", SslProfile: "tls"}, "plain": {Name: "plain"}},
+		Bridges: BridgeConfig{
+			TcpListeners:  map[string]TcpEndpoint{"web": {Name: "web", SslProfile: "tls"}},
+			TcpConnectors: map[string]TcpEndpoint{"db": {Name: "db", SslProfile: "other"}},
+		},
+	}
+	if got := strings.Join(c.SslProfileUsers("tls"), ","); got != "connector uplink,listener amqps,tcpListener web" {
+		t.Errorf("SslProfileUsers(tls) = %s", got)
+	}
+	if c.ReferencesSslProfile("unused") || !c.ReferencesSslProfile("other") {
+		t.Errorf("ReferencesSslProfile() does not match SslProfileUsers()")
+	}
+}
+
+func TestTcpEndpointMapDifference(t *testing.T) {
+	verify := true
+	noVerify := false
+	actual := TcpEndpointMap{
+		"web":  {Name: "web", Port: "8080", Address: "web", SiteId: "site-a"},
+		"db":   {Name: "db", Host: "db", Port: "5432", Address: "db", VerifyHostname: &verify},
+		"api":  {Name: "api", Port: "9090", Address: "api"},
+		"gone": {Name: "gone", Port: "7070", Address: "gone"},
+	}
+	desired := TcpEndpointMap{
+		"web": {Name: "web", Host: "0.0.0.0", Port: "8080", Address: "web", SiteId: "site-b"},
+		"db":  {Name: "db", Host: "db", Port: "5432", Address: "db", VerifyHostname: &noVerify},
+		"api": {Name: "api", Port: "9091", Address: "api"},
+		"new": {Name: "new", Port: "6060", Address: "new"},
+	}
+	changes := actual.Difference(desired)
+	if len(changes.Added) != 1 || changes.Added[0].Name != "new" {
+		t.Errorf("Added = %v, want [new]", changes.Added)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "gone" {
+		t.Errorf("Deleted = %v, want [gone]", changes.Deleted)
+	}
+	updated := map[string]TcpEndpointChange{}
+	for _, change := range changes.Updated {
+		updated[change.Name] = change
+	}
+	if len(updated) != 3 {
+		t.Fatalf("Updated = %v, want web, db and api", changes.Updated)
+	}
+	if c := updated["web"]; c.Strategy != UpdateInPlace || len(c.Fields) != 1 || c.Fields[0] != "siteId" {
+		t.Errorf("web change = %+v, want in place siteId update", c)
+	}
+	if c := updated["db"]; c.Strategy != UpdateInPlace || len(c.Fields) != 1 || c.Fields[0] != "verifyHostname" {
+		t.Errorf("db change = %+v, want in place verifyHostname update", c)
+	}
+	if c := updated["api"]; c.Strategy != UpdateReplace || len(c.Fields) != 1 || c.Fields[0] != "port" {
+		t.Errorf("api change = %+v, want port replacement", c)
+	}
+	if len(changes.Replaced()) != 1 || len(changes.UpdatedInPlace()) != 2 {
+		t.Errorf("Replaced = %v, UpdatedInPlace = %v", changes.Replaced(), changes.UpdatedInPlace())
+	}
+}
+
+func testRouterConfig() RouterConfig {
+	return RouterConfig{
+		Metadata: RouterMetadata{Id: "router-a", Mode: ModeInterior},
+		Listeners: map[string]Listener{
+			"amqp":  {Name: "amqp", Host: "localhost", Port: 5672},
+			"edge":  {Name: "edge", Role: RoleEdge, Port: 45671},
+			"inter": {Name: "inter", Role: RoleInterRouter, Port: 55671},
+		},
+		Addresses: map[string]Address{
+			"mc":  {Prefix: "mc", Distribution: DistributionMulticast},
+			"bal": {Prefix: "bal", Distribution: string(DistributionBalanced)},
+		},
+		Bridges: BridgeConfig{
+			TcpListeners: map[string]TcpEndpoint{
+				"web": {Name: "web", Port: "8080", Address: "web"},
+				"api": {Name: "api", Port: "9090", Address: "api"},
+				"db":  {Name: "db", Port: "5432", Address: "db"},
+			},
+		},
+	}
+}
+
+// fakeWriter records the operations applied to it and fails the UPDATEs of the
+// entities in refuse with the given status.
+type fakeWriter struct {
+	refuse map[string]int
+	ops    []string
+}
+
+func (w *fakeWriter) Create(typename string, name string, entity recordType) error {
+	w.ops = append(w.ops, "CREATE "+name)
+	return nil
+}
+
+func (w *fakeWriter) Update(typename string, name string, entity recordType) error {
+	if status, ok := w.refuse[name]; ok {
+		return &ManagementError{Operation: "UPDATE", Type: typename, Name: name, StatusCode: status}
+	}
+	w.ops = append(w.ops, "UPDATE "+name)
+	return nil
+}
+
+func (w *fakeWriter) Delete(typename string, name string) error {
+	w.ops = append(w.ops, "DELETE "+name)
+	return nil
+}
+
+func TestUpdateTcpEndpointsFallsBackToReplace(t *testing.T) {
+	changes := []TcpEndpointChange{
+		{Name: "web", Desired: TcpEndpoint{Name: "web", SiteId: "site-b"}},
+		{Name: "db", Desired: TcpEndpoint{Name: "db", ProcessID: "db-2"}},
+		{Name: "cache", Desired: TcpEndpoint{Name: "cache", SiteId: "site-b"}},
+	}
+	w := &fakeWriter{refuse: map[string]int{"db": 501, "cache": 400}}
+	if err := updateTcpEndpoints(w, "io.skupper.router.tcpListener", changes); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"UPDATE web", "DELETE db", "CREATE db", "DELETE cache", "CREATE cache"}
+	if !slices.Equal(w.ops, want) {
+		t.Errorf("operations = %v, want %v", w.ops, want)
+	}
+
+	w = &fakeWriter{refuse: map[string]int{"web": 500}}
+	if err := updateTcpEndpoints(w, "io.skupper.router.tcpListener", changes); err == nil || len(w.ops) != 0 {
+		t.Errorf("server error: %v, operations %v, want the error returned without replacing", err, w.ops)
+	}
+}
+
+func TestMarshalRouterConfigIsStable(t *testing.T) {
+	config := testRouterConfig()
+	first, err := MarshalRouterConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if data, _ := MarshalRouterConfig(config); data != first {
+			t.Fatalf("marshal %d differs:\n%s\nwant\n%s", i, data, first)
+		}
+	}
+	unmarshalled, err := UnmarshalRouterConfig(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := MarshalRouterConfig(unmarshalled); again != first {
+		t.Errorf("round trip changed config:\n%s\nwant\n%s", again, first)
+	}
+	if api, web := strings.Index(first, `"api"`), strings.Index(first, `"web"`); api < 0 || api > web {
+		t.Errorf("tcpListeners not sorted by name:\n%s", first)
+	}
+}
+
+func TestRouterConfigEquals(t *testing.T) {
+	config := testRouterConfig()
+	data, _ := MarshalRouterConfig(config)
+	unmarshalled, _ := UnmarshalRouterConfig(data)
+	if !config.Equals(unmarshalled) {
+		t.Errorf("config with nil maps should equal its unmarshalled copy")
+	}
+
+	reordered := `[["tcpListener", {"name": "web", "port": "8080", "address": "web"}], ["router", {"id": "router-a"}]]`
+	original := `[["router", {"id": "router-a"}], ["tcpListener", {"address": "web", "port": "8080", "name": "web"}]]`
+	if !RouterConfigEquals(reordered, original) {
+		t.Errorf("reordered config should be equal")
+	}
+
+	changed := testRouterConfig()
+	changed.Bridges.TcpListeners["web"] = TcpEndpoint{Name: "web", Port: "8081", Address: "web"}
+	if config.Equals(changed) {
+		t.Errorf("config with changed port should not be equal")
+	}
+}
+
+func TestParseRouterConfigDiagnostics(t *testing.T) {
+	config := `[
+		["router", {"id": "router-a", "mode": "interior"}],
+		["tcpListner", {"name": "web", "port": "8080"}],
+		["tcpListener", {"name": "api", "port": "9090", "adress": "api", "prot": "tcp"}],
+		["log", {"module": "DEFAULT", "enable": "info+"}]
+	]`
+	result, diagnostics, err := ParseRouterConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigDiagnostic{
+		{Index: 1, Type: "tcpListner", Message: "unknown entity type"},
+		{Index: 2, Type: "tcpListener", Field: "adress", Message: "unknown attribute"},
+		{Index: 2, Type: "tcpListener", Field: "prot", Message: "unknown attribute"},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("diagnostics = %v, want %v", diagnostics, want)
+	}
+	for i := range want {
+		if diagnostics[i] != want[i] {
+			t.Errorf("diagnostic %d = %v, want %v", i, diagnostics[i], want[i])
+		}
+	}
+	if _, ok := result.Bridges.TcpListeners["api"]; !ok || len(result.Bridges.TcpListeners) != 1 {
+		t.Errorf("TcpListeners = %v, want api only", result.Bridges.TcpListeners)
+	}
+	err = &ConfigDiagnosticsError{Diagnostics: diagnostics}
+	if !strings.Contains(err.Error(), `element 2 (tcpListener): unknown attribute "prot"`) {
+		t.Errorf("Error() = %q", err)
+	}
+
+	if _, diagnostics, _ := ParseRouterConfig(`[["router", {"id": "router-a"}]]`); len(diagnostics) != 0 {
+		t.Errorf("diagnostics = %v, want none", diagnostics)
+	}
+}
@@ -0,0 +1,170 @@
+package qdr
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// rawEntityTypes are the skrouterd entity types that the config model does not
+// know, but that are kept as RawEntities and passed to the router as they are.
+// Other unknown types are most likely typos: querying the router for them
+// would fail every update, so they are dropped and reported by
+// ParseRouterConfig, which strict mode rejects.
+var rawEntityTypes = []string{
+	"vhost",
+	"authServicePlugin",
+}
+
+// RawEntity is a router entity of a type the config model does not know. It
+// is kept as its attributes, so it can be written back to the config file and
+// reconciled by type and name.
+type RawEntity struct {
+	// Type is the entity type as written in the config file, e.g. vhost
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Name returns the name attribute of the entity, which identifies it over
+// management. Entities without one are written back to the config file but
+// cannot be reconciled on a running router.
+func (e RawEntity) Name() string {
+	name, _ := e.Attributes["name"].(string)
+	return name
+}
+
+func (e RawEntity) managementType() string {
+	return "io.skupper.router." + e.Type
+}
+
+func (e RawEntity) key() string {
+	return e.Type + "/" + e.Name()
+}
+
+func (e RawEntity) String() string {
+	return e.key()
+}
+
+func (e RawEntity) toRecord() Record {
+	return e.Attributes
+}
+
+// matches returns true if every attribute of desired has the same value in e.
+// Values are compared as text, as numbers read from the config file and from
+// the router have different types.
+func (e RawEntity) matches(desired RawEntity) bool {
+	for name, value := range desired.Attributes {
+		if fmt.Sprint(e.Attributes[name]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRawEntities returns a copy of entities sorted by type and name, or nil if
+// there are none.
+func sortRawEntities(entities []RawEntity) []RawEntity {
+	if len(entities) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(entities)
+	slices.SortStableFunc(sorted, func(a, b RawEntity) int {
+		return strings.Compare(a.key(), b.key())
+	})
+	return sorted
+}
+
+// RawEntityTypes returns the types of the given raw entities, sorted and
+// without duplicates.
+func RawEntityTypes(entities ...[]RawEntity) []string {
+	var types []string
+	for _, list := range entities {
+		for _, e := range list {
+			if !slices.Contains(types, e.Type) {
+				types = append(types, e.Type)
+			}
+		}
+	}
+	slices.Sort(types)
+	return types
+}
+
+type RawEntityDifference struct {
+	Deleted []RawEntity
+	Added   []RawEntity
+}
+
+func (d RawEntityDifference) Empty() bool {
+	return len(d.Deleted) == 0 && len(d.Added) == 0
+}
+
+// RawEntitiesDifference compares the named raw entities on the router with the
+// desired ones. An entity whose attributes changed is both deleted and added,
+// as the attributes of arbitrary types cannot be assumed to be updatable.
+func RawEntitiesDifference(actual []RawEntity, desired []RawEntity) RawEntityDifference {
+	result := RawEntityDifference{}
+	current := map[string]RawEntity{}
+	for _, e := range actual {
+		if e.Name() != "" {
+			current[e.key()] = e
+		}
+	}
+	wanted := map[string]bool{}
+	for _, e := range sortRawEntities(desired) {
+		if e.Name() == "" {
+			log.Printf("WARN: Cannot reconcile %s entity without a name", e.Type)
+			continue
+		}
+		wanted[e.key()] = true
+		existing, ok := current[e.key()]
+		if ok && existing.matches(e) {
+			continue
+		}
+		if ok {
+			result.Deleted = append(result.Deleted, existing)
+		}
+		result.Added = append(result.Added, e)
+	}
+	for _, e := range sortRawEntities(actual) {
+		if e.Name() != "" && !wanted[e.key()] {
+			result.Deleted = append(result.Deleted, e)
+		}
+	}
+	return result
+}
+
+// GetRawEntities returns the entities of the given types on the router.
+func (a *Agent) GetRawEntities(typenames []string) ([]RawEntity, error) {
+	var entities []RawEntity
+	for _, typename := range typenames {
+		e := RawEntity{Type: typename}
+		records, err := a.Query(e.managementType(), []string{})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			// Drop the attributes set by management, which cannot be created
+			delete(record, "identity")
+			delete(record, "type")
+			entities = append(entities, RawEntity{Type: typename, Attributes: record})
+		}
+	}
+	return entities, nil
+}
+
+// UpdateRawEntities deletes and then creates raw entities as described by
+// changes.
+func (a *Agent) UpdateRawEntities(changes RawEntityDifference) error {
+	for _, deleted := range changes.Deleted {
+		if err := a.Delete(deleted.managementType(), deleted.Name()); err != nil {
+			return fmt.Errorf("Error deleting %s: %s", deleted, err)
+		}
+	}
+	for _, added := range changes.Added {
+		if err := a.Create(added.managementType(), added.Name(), added); err != nil {
+			return fmt.Errorf("Error creating %s: %s", added, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package qdr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRawEntitiesRoundTrip(t *testing.T) {
+	config := `[
+		["router", {"id": "router-a"}],
+		["vhost", {"name": "public", "hostname": "public", "maxConnections": 100}],
+		["authServicePlugin", {"name": "auth", "host": "auth.example.com", "port": 5671}],
+		["tcpListner", {"name": "web"}]
+	]`
+	result, diagnostics, err := ParseRouterConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Type != "tcpListner" {
+		t.Errorf("diagnostics = %v, want only the unknown tcpListner", diagnostics)
+	}
+	if len(result.RawEntities) != 2 {
+		t.Fatalf("RawEntities = %v, want vhost and authServicePlugin", result.RawEntities)
+	}
+
+	data, err := MarshalRouterConfig(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(data, `"vhost"`) || !strings.Contains(data, `"auth.example.com"`) || strings.Contains(data, "tcpListner") {
+		t.Errorf("marshalled config lost raw entities or kept unknown ones:\n%s", data)
+	}
+	again, _, err := ParseRouterConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Equals(result) {
+		t.Errorf("round trip changed config: %v, want %v", again.RawEntities, result.RawEntities)
+	}
+	if e := again.entity("io.skupper.router.vhost", "public"); e == nil {
+		t.Errorf("entity() did not find raw vhost")
+	}
+}
+
+func TestRawEntitiesDifference(t *testing.T) {
+	actual := []RawEntity{
+		// As queried from the router, with numbers of another type and defaults
+		{Type: "authServicePlugin", Attributes: map[string]interface{}{"name": "auth", "host": "auth-a", "port": int64(5671), "realm": ""}},
+		{Type: "vhost", Attributes: map[string]interface{}{"name": "public", "maxConnections": int64(100)}},
+		{Type: "vhost", Attributes: map[string]interface{}{"name": "old", "maxConnections": int64(10)}},
+	}
+	desired := []RawEntity{
+		{Type: "vhost", Attributes: map[string]interface{}{"name": "public", "maxConnections": float64(100)}},
+		{Type: "authServicePlugin", Attributes: map[string]interface{}{"name": "auth", "host": "auth-b", "port": float64(5671)}},
+		{Type: "vhost", Attributes: map[string]interface{}{"name": "private", "maxConnections": float64(5)}},
+		{Type: "vhost", Attributes: map[string]interface{}{"hostname": "unnamed"}},
+	}
+	changes := RawEntitiesDifference(actual, desired)
+	var added, deleted []string
+	for _, e := range changes.Added {
+		added = append(added, e.key())
+	}
+	for _, e := range changes.Deleted {
+		deleted = append(deleted, e.key())
+	}
+	if strings.Join(added, ",") != "authServicePlugin/auth,vhost/private" {
+		t.Errorf("Added = %v, want authServicePlugin/auth and vhost/private", added)
+	}
+	if strings.Join(deleted, ",") != "authServicePlugin/auth,vhost/old" {
+		t.Errorf("Deleted = %v, want authServicePlugin/auth and vhost/old", deleted)
+	}
+	if !RawEntitiesDifference(actual[:2], actual[:2]).Empty() {
+		t.Errorf("expected no changes for identical entities")
+	}
+	if types := RawEntityTypes(actual, desired); strings.Join(types, ",") != "authServicePlugin,vhost" {
+		t.Errorf("RawEntityTypes() = %v", types)
+	}
+}
+
+func TestParseRouterConfigDropsUnknownTypes(t *testing.T) {
+	config := `[
+		["router", {"id": "router-a"}],
+		["tcpListner", {"name": "web", "port": "8080", "address": "web"}],
+		["vhost", {"name": "public", "hostname": "public"}]
+	]`
+	result, diagnostics, err := ParseRouterConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Type != "tcpListner" || diagnostics[0].Message != "unknown entity type" {
+		t.Errorf("diagnostics = %v, want the tcpListner typo reported", diagnostics)
+	}
+	if types := RawEntityTypes(result.RawEntities); len(types) != 1 || types[0] != "vhost" {
+		t.Errorf("raw entity types = %v, want only vhost to be queried on the router", types)
+	}
+	if len(result.Bridges.TcpListeners) != 0 {
+		t.Errorf("TcpListeners = %v, want the typo not taken for a tcpListener", result.Bridges.TcpListeners)
+	}
+}
@@ -42,6 +42,66 @@ func GetRouterLogging(routerConfig *RouterConfig) []types.RouterLogConfig {
 	return ret
 }
 
+const (
+	// LogLevelDefault makes a module inherit the level of the DEFAULT module
+	LogLevelDefault = "default"
+	// LogLevelDefaultModule is the level the router starts the DEFAULT module with
+	LogLevelDefaultModule = "info+"
+)
+
+type LogConfigDifference struct {
+	Updated []LogConfig
+}
+
+func (a *LogConfigDifference) Empty() bool {
+	return len(a.Updated) == 0
+}
+
+// resetLogConfig returns the level a module reverts to when it is no longer
+// configured. Log entities always exist in the router, so they are never
+// deleted, only updated.
+func resetLogConfig(module string) LogConfig {
+	if module == "DEFAULT" {
+		return LogConfig{Module: module, Enable: LogLevelDefaultModule}
+	}
+	return LogConfig{Module: module, Enable: LogLevelDefault}
+}
+
+func equivalentLogLevel(a string, b string) bool {
+	if a == "" {
+		a = LogLevelDefault
+	}
+	if b == "" {
+		b = LogLevelDefault
+	}
+	return a == b
+}
+
+// LogConfigsDifference compares the log modules of the router with the desired
+// ones (both keyed by module). Modules that are no longer desired are reset to
+// their default level.
+func LogConfigsDifference(actual map[string]LogConfig, desired map[string]LogConfig) *LogConfigDifference {
+	result := LogConfigDifference{}
+	for module, desiredValue := range desired {
+		if desiredValue.Module == "" {
+			desiredValue.Module = module
+		}
+		if actualValue, ok := actual[module]; !ok || !equivalentLogLevel(desiredValue.Enable, actualValue.Enable) {
+			result.Updated = append(result.Updated, desiredValue)
+		}
+	}
+	for module, actualValue := range actual {
+		if _, ok := desired[module]; ok {
+			continue
+		}
+		reset := resetLogConfig(module)
+		if !equivalentLogLevel(reset.Enable, actualValue.Enable) {
+			result.Updated = append(result.Updated, reset)
+		}
+	}
+	return &result
+}
+
 func ParseRouterLogConfig(config string) ([]types.RouterLogConfig, error) {
 	items := strings.Split(config, ",")
 	parsed := []types.RouterLogConfig{}
@@ -0,0 +1,53 @@
+package qdr
+
+import (
+	"testing"
+)
+
+func TestLogConfigsDifference(t *testing.T) {
+	actual := map[string]LogConfig{
+		"DEFAULT":      {Module: "DEFAULT", Enable: "info+"},
+		"ROUTER":       {Module: "ROUTER", Enable: "default"},
+		"TCP_ADAPTOR":  {Module: "TCP_ADAPTOR", Enable: "trace+"},
+		"HTTP_ADAPTOR": {Module: "HTTP_ADAPTOR", Enable: "default"},
+	}
+
+	// Turning a module on only updates that module
+	changes := LogConfigsDifference(actual, map[string]LogConfig{
+		"DEFAULT":      {Module: "DEFAULT", Enable: "info+"},
+		"TCP_ADAPTOR":  {Module: "TCP_ADAPTOR", Enable: "trace+"},
+		"HTTP_ADAPTOR": {Module: "HTTP_ADAPTOR", Enable: "debug+"},
+	})
+	if len(changes.Updated) != 1 || changes.Updated[0].Module != "HTTP_ADAPTOR" || changes.Updated[0].Enable != "debug+" {
+		t.Errorf("Updated = %v, want only HTTP_ADAPTOR at debug+", changes.Updated)
+	}
+
+	// Removing a module resets it to the default level
+	changes = LogConfigsDifference(actual, map[string]LogConfig{
+		"DEFAULT": {Module: "DEFAULT", Enable: "warning+"},
+	})
+	updated := map[string]string{}
+	for _, l := range changes.Updated {
+		updated[l.Module] = l.Enable
+	}
+	want := map[string]string{
+		"DEFAULT":     "warning+",
+		"TCP_ADAPTOR": LogLevelDefault,
+	}
+	if len(updated) != len(want) {
+		t.Fatalf("Updated = %v, want %v", updated, want)
+	}
+	for module, level := range want {
+		if updated[module] != level {
+			t.Errorf("module %s level = %q, want %q", module, updated[module], level)
+		}
+	}
+
+	// Removing DEFAULT resets it to the router's initial level
+	changes = LogConfigsDifference(map[string]LogConfig{
+		"DEFAULT": {Module: "DEFAULT", Enable: "trace+"},
+	}, map[string]LogConfig{})
+	if len(changes.Updated) != 1 || changes.Updated[0].Enable != LogLevelDefaultModule {
+		t.Errorf("Updated = %v, want DEFAULT reset to %s", changes.Updated, LogLevelDefaultModule)
+	}
+}
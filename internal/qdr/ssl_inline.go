@@ -0,0 +1,143 @@
+package qdr
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/datasance/router/internal/utils"
+)
+
+// HasInlinePem returns true if the profile carries PEM content rather than
+// only file paths.
+func (p SslProfile) HasInlinePem() bool {
+	return p.Cert != "" || p.Key != "" || p.CaCert != ""
+}
+
+// SslProfileStage holds the inline PEM content written by StageSslProfile
+// until the config using it is applied. Content for files that already exist
+// is kept in temporary files, so the router keeps reading the old files until
+// Commit swaps them in; Discard drops the staged content and removes the files
+// that did not exist before.
+type SslProfileStage struct {
+	// Changed names the profiles whose files change, which need to be reloaded
+	// on the router once committed
+	Changed []string
+	pending map[string]string
+	created []string
+}
+
+// Commit renames the staged content over the files of the profiles.
+func (s *SslProfileStage) Commit() error {
+	var errs []string
+	for _, path := range slices.Sorted(maps.Keys(s.pending)) {
+		if err := os.Rename(s.pending[path], path); err != nil {
+			os.Remove(s.pending[path])
+			errs = append(errs, err.Error())
+		}
+	}
+	s.pending = nil
+	s.created = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("Failed to replace SSL profile files: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Discard removes the staged content and the files and directories written
+// for profiles that had none, leaving the files the router uses as they were.
+func (s *SslProfileStage) Discard() {
+	for _, tmp := range s.pending {
+		os.Remove(tmp)
+	}
+	// Created directories come before their files, so remove in reverse
+	for i := len(s.created) - 1; i >= 0; i-- {
+		os.Remove(s.created[i])
+	}
+	s.pending = nil
+	s.created = nil
+}
+
+// StageSslProfile prepares the inline PEM content of profile to be written to
+// ca.crt, tls.crt and tls.key under dir/<name>, the same layout as profiles
+// found under SSL_PROFILE_PATH, and returns the profile pointing at those
+// files. Keys are only readable by the owner. Files that do not exist yet are
+// written immediately, so the profile can be created on the router; changed
+// content of existing files waits in stage for Commit.
+func StageSslProfile(profile SslProfile, dir string, stage *SslProfileStage) (SslProfile, error) {
+	if !profile.HasInlinePem() {
+		return profile, nil
+	}
+	if profile.Key != "" && profile.Cert == "" {
+		return profile, fmt.Errorf("SSL profile %s has an inline key but no certificate", profile.Name)
+	}
+	files := []struct {
+		content string
+		name    string
+		perm    os.FileMode
+		path    *string
+	}{
+		{profile.CaCert, "ca.crt", 0644, &profile.CaCertFile},
+		{profile.Cert, "tls.crt", 0644, &profile.CertFile},
+		{profile.Key, "tls.key", 0600, &profile.PrivateKeyFile},
+	}
+	for _, f := range files {
+		if f.content == "" {
+			continue
+		}
+		if block, _ := pem.Decode([]byte(f.content)); block == nil {
+			return profile, fmt.Errorf("SSL profile %s: %s is not PEM encoded", profile.Name, f.name)
+		}
+	}
+	if profile.Key != "" {
+		if _, err := tls.X509KeyPair([]byte(profile.Cert), []byte(profile.Key)); err != nil {
+			return profile, fmt.Errorf("SSL profile %s: key does not match certificate: %s", profile.Name, err)
+		}
+	}
+	profileDir := filepath.Join(dir, profile.Name)
+	if _, err := os.Stat(profileDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(profileDir, 0700); err != nil {
+			return profile, fmt.Errorf("Failed to create directory for SSL profile %s: %s", profile.Name, err)
+		}
+		stage.created = append(stage.created, profileDir)
+	}
+	changed := false
+	for _, f := range files {
+		if f.content == "" {
+			continue
+		}
+		filename := filepath.Join(profileDir, f.name)
+		*f.path = filename
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			if _, err := utils.WriteFileAtomic(filename, []byte(f.content), f.perm); err != nil {
+				return profile, fmt.Errorf("Failed to write %s for SSL profile %s: %s", f.name, profile.Name, err)
+			}
+			stage.created = append(stage.created, filename)
+			changed = true
+			continue
+		}
+		tmp, err := utils.StageFile(filename, []byte(f.content), f.perm)
+		if err != nil {
+			return profile, fmt.Errorf("Failed to write %s for SSL profile %s: %s", f.name, profile.Name, err)
+		}
+		if tmp != "" {
+			if stage.pending == nil {
+				stage.pending = make(map[string]string)
+			}
+			stage.pending[filename] = tmp
+			changed = true
+		}
+	}
+	if changed {
+		stage.Changed = append(stage.Changed, profile.Name)
+	}
+	profile.Cert = ""
+	profile.Key = ""
+	profile.CaCert = ""
+	return profile, nil
+}
@@ -0,0 +1,105 @@
+package qdr
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageSslProfile(t *testing.T) {
+	source := t.TempDir()
+	writeTestCertificate(t, source)
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(source, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	inline := SslProfile{Name: "broker", CaCert: read("ca.crt"), Cert: read("tls.crt"), Key: read("tls.key")}
+
+	// Files that do not exist yet are written right away
+	dir := t.TempDir()
+	stage := &SslProfileStage{}
+	profile, err := StageSslProfile(inline, dir, stage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stage.Changed) != 1 || profile.HasInlinePem() {
+		t.Errorf("got %+v, changed %v, want files written and inline content cleared", profile, stage.Changed)
+	}
+	if profile.PrivateKeyFile != filepath.Join(dir, "broker", "tls.key") || profile.CaCertFile != filepath.Join(dir, "broker", "ca.crt") {
+		t.Errorf("profile paths = %+v", profile)
+	}
+	if info, err := os.Stat(profile.PrivateKeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v, want 0600", info.Mode(), err)
+	}
+	if _, err := tls.LoadX509KeyPair(profile.CertFile, profile.PrivateKeyFile); err != nil {
+		t.Errorf("written files are not a usable key pair: %v", err)
+	}
+	if _, err := (&ManagementConfig{SslProfile: &profile}).GetTlsConfig(); err != nil {
+		t.Errorf("written files are not a usable profile: %v", err)
+	}
+	if err := stage.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	stage = &SslProfileStage{}
+	if _, err := StageSslProfile(inline, dir, stage); err != nil || len(stage.Changed) != 0 {
+		t.Errorf("unchanged content: changed %v, %v, want no change", stage.Changed, err)
+	}
+
+	// Changed content of existing files waits for Commit
+	rotated := inline
+	rotated.CaCert = "\n" + inline.CaCert
+	stage = &SslProfileStage{}
+	if _, err := StageSslProfile(rotated, dir, stage); err != nil || len(stage.Changed) != 1 {
+		t.Fatalf("rotated content: changed %v, %v", stage.Changed, err)
+	}
+	if data, _ := os.ReadFile(profile.CaCertFile); string(data) != inline.CaCert {
+		t.Errorf("ca.crt replaced before Commit")
+	}
+	stage.Discard()
+	if data, _ := os.ReadFile(profile.CaCertFile); string(data) != inline.CaCert {
+		t.Errorf("ca.crt replaced by Discard")
+	}
+	stage = &SslProfileStage{}
+	if _, err := StageSslProfile(rotated, dir, stage); err != nil || len(stage.Changed) != 1 {
+		t.Fatalf("discarded content should be staged again: changed %v, %v", stage.Changed, err)
+	}
+	if err := stage.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(profile.CaCertFile); string(data) != rotated.CaCert {
+		t.Errorf("ca.crt not replaced by Commit")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "broker")); len(entries) != 3 {
+		t.Errorf("profile dir has %d entries, want no temporary files left", len(entries))
+	}
+
+	// Discarding a new profile removes its files
+	stage = &SslProfileStage{}
+	if _, err := StageSslProfile(SslProfile{Name: "new", CaCert: inline.CaCert}, dir, stage); err != nil {
+		t.Fatal(err)
+	}
+	stage.Discard()
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Errorf("files of a discarded new profile were kept: %v", err)
+	}
+
+	for _, bad := range []SslProfile{
+		{Name: "bad", CaCert: "not pem"},
+		{Name: "keyonly", Key: inline.Key},
+		{Name: "corruptkey", Cert: inline.Cert, Key: strings.Replace(inline.Key, "A", "B", 1)},
+	} {
+		if _, err := StageSslProfile(bad, dir, &SslProfileStage{}); err == nil {
+			t.Errorf("expected error for profile %s", bad.Name)
+		}
+	}
+	files := SslProfile{Name: "files", CaCertFile: "/etc/certs/ca.crt"}
+	if got, err := StageSslProfile(files, dir, &SslProfileStage{}); err != nil || got != files {
+		t.Errorf("profile without inline content = %+v, %v, want unchanged", got, err)
+	}
+}
@@ -0,0 +1,189 @@
+package qdr
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Operation is a management operation applied to the router as part of a
+// Transaction, along with what is needed to undo it.
+type Operation struct {
+	Operation string
+	Type      string
+	Name      string
+	Entity    recordType
+	// Previous holds the entity as it was before an UPDATE or DELETE, when known
+	Previous recordType
+}
+
+func (o Operation) String() string {
+	return fmt.Sprintf("%s %s %s", o.Operation, o.Type, o.Name)
+}
+
+// Transaction records the operations an Agent applies, so they can be undone
+// if a later operation fails.
+type Transaction struct {
+	agent   *Agent
+	before  *RouterConfig
+	applied []Operation
+	failed  *Operation
+}
+
+// TransactionError reports the operation that failed and the outcome of
+// rolling back the operations applied before it.
+type TransactionError struct {
+	// Failed is nil when the failure did not come from a management operation
+	Failed         *Operation
+	Err            error
+	Applied        []Operation
+	RollbackErrors []error
+}
+
+func (e *TransactionError) Error() string {
+	var msg string
+	if e.Failed != nil {
+		msg = fmt.Sprintf("%s failed: %s", e.Failed, e.Err)
+	} else {
+		msg = e.Err.Error()
+	}
+	if len(e.RollbackErrors) > 0 {
+		errs := make([]string, len(e.RollbackErrors))
+		for i, err := range e.RollbackErrors {
+			errs[i] = err.Error()
+		}
+		return fmt.Sprintf("%s (rollback of %d operations incomplete: %s)", msg, len(e.Applied), strings.Join(errs, ", "))
+	}
+	return fmt.Sprintf("%s (rolled back %d operations)", msg, len(e.Applied))
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// Begin starts recording the operations applied through the agent. The
+// before config is the state of the router at the start, used to restore
+// entities that get updated or deleted.
+func (a *Agent) Begin(before *RouterConfig) *Transaction {
+	a.tx = &Transaction{
+		agent:  a,
+		before: before,
+	}
+	return a.tx
+}
+
+// Applied returns the operations applied so far.
+func (t *Transaction) Applied() []Operation {
+	return t.applied
+}
+
+func (t *Transaction) record(op Operation, err error) {
+	if err != nil {
+		t.failed = &op
+		return
+	}
+	// A failure followed by a success was handled by the caller, e.g. an
+	// UPDATE the router refused that was applied as DELETE and CREATE instead
+	t.failed = nil
+	if op.Operation != "CREATE" && t.before != nil {
+		op.Previous = t.before.entity(op.Type, op.Name)
+	}
+	t.applied = append(t.applied, op)
+}
+
+// Commit stops recording, keeping the applied operations.
+func (t *Transaction) Commit() {
+	if t.agent.tx == t {
+		t.agent.tx = nil
+	}
+}
+
+// Rollback undoes the applied operations in reverse order and returns a
+// TransactionError describing the failure that caused it.
+func (t *Transaction) Rollback(cause error) *TransactionError {
+	t.Commit()
+	result := &TransactionError{
+		Failed:  t.failed,
+		Err:     cause,
+		Applied: t.applied,
+	}
+	for i := len(t.applied) - 1; i >= 0; i-- {
+		op := t.applied[i]
+		var err error
+		switch op.Operation {
+		case "CREATE":
+			err = t.agent.Delete(op.Type, op.Name)
+		case "UPDATE":
+			if op.Previous == nil {
+				err = fmt.Errorf("previous state unknown")
+			} else {
+				err = t.agent.Update(op.Type, op.Name, op.Previous)
+			}
+		case "DELETE":
+			if op.Previous == nil {
+				err = fmt.Errorf("previous state unknown")
+			} else {
+				err = t.agent.Create(op.Type, op.Name, op.Previous)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to undo %s: %s", op, err)
+			result.RollbackErrors = append(result.RollbackErrors, fmt.Errorf("undo %s: %s", op, err))
+		}
+	}
+	return result
+}
+
+// entity returns the entity of the given management type and name, or nil
+// if there is none.
+func (r *RouterConfig) entity(typename string, name string) recordType {
+	switch typename {
+	case "io.skupper.router.sslProfile":
+		if e, ok := r.SslProfiles[name]; ok {
+			return e
+		}
+	case "io.skupper.router.listener":
+		if e, ok := r.Listeners[name]; ok {
+			return e
+		}
+	case "io.skupper.router.connector":
+		if e, ok := r.Connectors[name]; ok {
+			return e
+		}
+	case "io.skupper.router.router.config.address":
+		for _, e := range r.Addresses {
+			if e.entityName() == name {
+				return e
+			}
+		}
+	case "io.skupper.router.log":
+		for _, e := range r.LogConfig {
+			if getLogEntityName(e.Module) == name {
+				return e
+			}
+		}
+	case "io.skupper.router.tcpListener":
+		if e, ok := r.Bridges.TcpListeners[name]; ok {
+			return e
+		}
+	case "io.skupper.router.tcpConnector":
+		if e, ok := r.Bridges.TcpConnectors[name]; ok {
+			return e
+		}
+	case "io.skupper.router.router.config.linkRoute":
+		if e, ok := r.LinkRoutes[name]; ok {
+			return e
+		}
+	case "io.skupper.router.router.config.autoLink":
+		if e, ok := r.AutoLinks[name]; ok {
+			return e
+		}
+	default:
+		for _, e := range r.RawEntities {
+			if e.managementType() == typename && e.Name() == name {
+				return e
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package qdr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransactionRecordsPreviousState(t *testing.T) {
+	before := &RouterConfig{
+		Listeners: map[string]Listener{
+			"amqp": {Name: "amqp", Host: "localhost", Port: 5672},
+		},
+		Addresses: map[string]Address{
+			"mc": {Name: "router.config.address/0", Prefix: "mc", Distribution: DistributionMulticast},
+		},
+		LogConfig: map[string]LogConfig{
+			"TCP_ADAPTOR": {Module: "TCP_ADAPTOR", Enable: "default"},
+		},
+		Bridges: BridgeConfig{
+			TcpListeners:  map[string]TcpEndpoint{"web": {Name: "web", Port: "8080", Address: "web"}},
+			TcpConnectors: map[string]TcpEndpoint{},
+		},
+	}
+	agent := &Agent{}
+	tx := agent.Begin(before)
+	tx.record(Operation{Operation: "DELETE", Type: "io.skupper.router.tcpListener", Name: "web"}, nil)
+	tx.record(Operation{Operation: "DELETE", Type: "io.skupper.router.router.config.address", Name: "router.config.address/0"}, nil)
+	tx.record(Operation{Operation: "UPDATE", Type: "io.skupper.router.log", Name: "log/TCP_ADAPTOR", Entity: LogConfig{Module: "TCP_ADAPTOR", Enable: "trace+"}}, nil)
+	tx.record(Operation{Operation: "CREATE", Type: "io.skupper.router.listener", Name: "amqp", Entity: Listener{Name: "amqp"}}, nil)
+	tx.record(Operation{Operation: "CREATE", Type: "io.skupper.router.tcpConnector", Name: "db"}, errors.New("bad request"))
+
+	applied := tx.Applied()
+	if len(applied) != 4 {
+		t.Fatalf("got %d applied operations, want 4", len(applied))
+	}
+	if e, ok := applied[0].Previous.(TcpEndpoint); !ok || e.Port != "8080" {
+		t.Errorf("tcpListener previous = %v, want web endpoint", applied[0].Previous)
+	}
+	if a, ok := applied[1].Previous.(Address); !ok || a.Prefix != "mc" {
+		t.Errorf("address previous = %v, want mc", applied[1].Previous)
+	}
+	if l, ok := applied[2].Previous.(LogConfig); !ok || l.Enable != "default" {
+		t.Errorf("log previous = %v, want default level", applied[2].Previous)
+	}
+	if applied[3].Previous != nil {
+		t.Errorf("create should not record previous state, got %v", applied[3].Previous)
+	}
+	if tx.failed == nil || tx.failed.Name != "db" {
+		t.Errorf("failed operation = %v, want CREATE tcpConnector db", tx.failed)
+	}
+
+	tx.Commit()
+	if agent.tx != nil {
+		t.Errorf("agent should stop recording after commit")
+	}
+}
+
+func TestTransactionError(t *testing.T) {
+	cause := errors.New("bad request")
+	err := &TransactionError{
+		Failed:  &Operation{Operation: "CREATE", Type: "io.skupper.router.tcpConnector", Name: "db"},
+		Err:     cause,
+		Applied: []Operation{{Operation: "DELETE", Type: "io.skupper.router.tcpListener", Name: "web"}},
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("TransactionError should unwrap to its cause")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "CREATE io.skupper.router.tcpConnector db failed") || !strings.Contains(msg, "rolled back 1 operations") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	err.RollbackErrors = []error{errors.New("undo DELETE io.skupper.router.tcpListener web: timeout")}
+	if msg := err.Error(); !strings.Contains(msg, "rollback of 1 operations incomplete") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
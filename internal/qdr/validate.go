@@ -0,0 +1,135 @@
+package qdr
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/datasance/router/internal/utils/validator"
+)
+
+// ConfigValidationError lists the violations found by RouterConfig.Validate.
+type ConfigValidationError struct {
+	Violations []string
+}
+
+func (e *ConfigValidationError) Error() string {
+	return fmt.Sprintf("Invalid router configuration: %s", strings.Join(e.Violations, "; "))
+}
+
+// Validate checks the config is consistent before it is applied: that
+// referenced SSL profiles exist, ports are in range, tcpListeners do not bind
+// the same address, an edge router has no inter-router listeners, address
+// distributions are known and link routes and auto-links are complete. It
+// returns a *ConfigValidationError listing every violation, or nil.
+func (c *RouterConfig) Validate() error {
+	var violations []string
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+	ports := validator.NewPortValidator()
+	// A listener without a port is given one by the router
+	listenerPorts := &validator.PortValidator{Min: 0, Max: ports.Max}
+	distributions := validator.NewOptionValidator([]string{string(DistributionBalanced), DistributionMulticast, DistributionClosest})
+	directions := validator.NewOptionValidator([]string{LinkDirectionIn, LinkDirectionOut})
+	checkSslProfile := func(kind string, name string, profile string) {
+		if _, ok := c.SslProfiles[profile]; profile != "" && !ok {
+			fail("%s %s: sslProfile %q does not exist", kind, name, profile)
+		}
+	}
+	checkPort := func(kind string, name string, port interface{}) {
+		if ok, err := ports.Evaluate(port); !ok {
+			fail("%s %s: %s", kind, name, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Listeners)) {
+		l := c.Listeners[name]
+		if ok, err := listenerPorts.Evaluate(l.Port); !ok {
+			fail("listener %s: %s", name, err)
+		}
+		checkSslProfile("listener", name, l.SslProfile)
+		if c.IsEdge() && l.Role == RoleInterRouter {
+			fail("listener %s: inter-router listener not allowed on an edge router", name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Connectors)) {
+		connector := c.Connectors[name]
+		checkPort("connector", name, connector.Port)
+		checkSslProfile("connector", name, connector.SslProfile)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Bridges.TcpConnectors)) {
+		e := c.Bridges.TcpConnectors[name]
+		checkPort("tcpConnector", name, e.Port)
+		checkSslProfile("tcpConnector", name, e.SslProfile)
+	}
+	bound := map[string][]TcpEndpoint{}
+	for _, name := range slices.Sorted(maps.Keys(c.Bridges.TcpListeners)) {
+		e := c.Bridges.TcpListeners[name]
+		checkPort("tcpListener", name, e.Port)
+		checkSslProfile("tcpListener", name, e.SslProfile)
+		for _, other := range bound[e.Port] {
+			if e.Host == other.Host || isWildcardHost(e.Host) || isWildcardHost(other.Host) {
+				fail("tcpListener %s: %s:%s is already bound by tcpListener %s", name, e.Host, e.Port, other.Name)
+				break
+			}
+		}
+		bound[e.Port] = append(bound[e.Port], e)
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.Addresses)) {
+		a := c.Addresses[key]
+		if a.Distribution == "" {
+			continue
+		}
+		if ok, err := distributions.Evaluate(a.Distribution); !ok {
+			fail("address %s: %s", key, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.LinkRoutes)) {
+		l := c.LinkRoutes[name]
+		if name == "" || l.Name != name {
+			fail("linkRoute %q: name must be set and match its key", name)
+		}
+		if (l.Prefix == "") == (l.Pattern == "") {
+			fail("linkRoute %s: exactly one of prefix and pattern must be set", name)
+		}
+		if ok, err := directions.Evaluate(l.Direction); !ok {
+			fail("linkRoute %s: direction %s", name, err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.AutoLinks)) {
+		l := c.AutoLinks[name]
+		if name == "" || l.Name != name {
+			fail("autoLink %q: name must be set and match its key", name)
+		}
+		if l.Address == "" {
+			fail("autoLink %s: address must be set", name)
+		}
+		if ok, err := directions.Evaluate(l.Direction); !ok {
+			fail("autoLink %s: direction %s", name, err)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ConfigValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// InlinePemSslProfiles returns the names of the SSL profiles with inline PEM
+// content, sorted.
+func (c *RouterConfig) InlinePemSslProfiles() []string {
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(c.SslProfiles)) {
+		if c.SslProfiles[name].HasInlinePem() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
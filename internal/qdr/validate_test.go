@@ -0,0 +1,69 @@
+package qdr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateValidConfig(t *testing.T) {
+	config := testRouterConfig()
+	config.SslProfiles = map[string]SslProfile{"inter-router": {Name: "inter-router"}}
+	config.Listeners["inter"] = Listener{Name: "inter", Role: RoleInterRouter, Port: 55671, SslProfile: "inter-router"}
+	config.Listeners["unset"] = Listener{Name: "unset"}
+	config.Bridges.TcpListeners["web-local"] = TcpEndpoint{Name: "web-local", Host: "127.0.0.1", Port: "8081", Address: "web"}
+	config.Bridges.TcpListeners["web-other"] = TcpEndpoint{Name: "web-other", Host: "10.0.0.1", Port: "8081", Address: "web"}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateReportsAllViolations(t *testing.T) {
+	config := RouterConfig{
+		Metadata: RouterMetadata{Id: "edge-a", Mode: ModeEdge},
+		Listeners: map[string]Listener{
+			"inter": {Name: "inter", Role: RoleInterRouter, Port: 55671},
+			"amqp":  {Name: "amqp", Port: 70000, SslProfile: "missing"},
+		},
+		Connectors: map[string]Connector{
+			"uplink": {Name: "uplink", Role: RoleEdge, Host: "interior", Port: "45671", SslProfile: "uplink-ca"},
+		},
+		Addresses: map[string]Address{
+			"mc": {Prefix: "mc", Distribution: "broadcast"},
+		},
+		Bridges: BridgeConfig{
+			TcpListeners: map[string]TcpEndpoint{
+				"a": {Name: "a", Port: "8080", Address: "a"},
+				"b": {Name: "b", Host: "127.0.0.1", Port: "8080", Address: "b"},
+			},
+			TcpConnectors: map[string]TcpEndpoint{
+				"db": {Name: "db", Host: "db", Port: "", Address: "db"},
+			},
+		},
+	}
+	err := config.Validate()
+	var validationErr *ConfigValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() = %v, want *ConfigValidationError", err)
+	}
+	for _, want := range []string{
+		`listener amqp: port 70000`,
+		`listener amqp: sslProfile "missing" does not exist`,
+		`listener inter: inter-router listener not allowed on an edge router`,
+		`connector uplink: sslProfile "uplink-ca" does not exist`,
+		`tcpConnector db: port "" is not a number`,
+		`tcpListener b: 127.0.0.1:8080 is already bound by tcpListener a`,
+		`address mc: value broadcast not allowed`,
+	} {
+		found := false
+		for _, v := range validationErr.Violations {
+			found = found || strings.HasPrefix(v, want)
+		}
+		if !found {
+			t.Errorf("missing violation %q in %v", want, validationErr.Violations)
+		}
+	}
+	if len(validationErr.Violations) != 7 {
+		t.Errorf("got %d violations, want 7: %v", len(validationErr.Violations), validationErr.Violations)
+	}
+}
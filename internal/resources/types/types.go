@@ -19,8 +19,26 @@ import (
 )
 
 const (
-	ENV_PLATFORM      = "SKUPPER_PLATFORM"
-	EnvSSLProfilePath = "SSL_PROFILE_PATH"
+	ENV_PLATFORM             = "SKUPPER_PLATFORM"
+	EnvSSLProfilePath        = "SSL_PROFILE_PATH"
+	EnvRouterRestartBackoff  = "ROUTER_RESTART_BACKOFF"
+	EnvRouterRestartMaxDelay = "ROUTER_RESTART_MAX_BACKOFF"
+	EnvRouterRestartLimit    = "ROUTER_RESTART_LIMIT"
+	EnvRouterRestartWindow   = "ROUTER_RESTART_WINDOW"
+	EnvRouterDrainTimeout    = "ROUTER_DRAIN_TIMEOUT"
+	EnvRouterStatusAddress   = "ROUTER_STATUS_ADDRESS"
+	EnvRouterConfigStrict    = "ROUTER_CONFIG_STRICT"
+	EnvInlineSslProfilePath  = "ROUTER_INLINE_SSL_PROFILE_PATH"
+	EnvCertExpiryWarning     = "ROUTER_CERT_EXPIRY_WARNING"
+	EnvRouterResyncInterval  = "ROUTER_RESYNC_INTERVAL"
+
+	EnvManagementUrl        = "ROUTER_MANAGEMENT_URL"
+	EnvManagementSslProfile = "ROUTER_MANAGEMENT_SSL_PROFILE"
+	EnvManagementSasl       = "ROUTER_MANAGEMENT_SASL_MECHANISM"
+	EnvManagementUsername   = "ROUTER_MANAGEMENT_USERNAME"
+	EnvManagementPassword   = "ROUTER_MANAGEMENT_PASSWORD"
+	EnvManagementPoolSize   = "ROUTER_MANAGEMENT_POOL_SIZE"
+	EnvManagementIdle       = "ROUTER_MANAGEMENT_IDLE_TIMEOUT"
 )
 
 const (
@@ -0,0 +1,110 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2023 Datasance Teknoloji A.S.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package router
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/datasance/router/internal/certs"
+	"github.com/datasance/router/internal/config"
+	"github.com/datasance/router/internal/metrics"
+	"github.com/datasance/router/internal/qdr"
+)
+
+// networkMetricsTTL is how long the network metrics are reused across
+// scrapes, as collecting them queries every router in the network.
+const networkMetricsTTL = 30 * time.Second
+
+// networkMetricsCache caches the network metrics. Its mutex is held while they are
+// collected, so concurrent scrapes wait for one query of the network.
+type networkMetricsCache struct {
+	mu        sync.Mutex
+	families  []metrics.Family
+	collected time.Time
+}
+
+// Metrics queries the router for the flow, link and network metrics and adds
+// the reconciliation metrics. Metrics that cannot be queried are left out.
+func (router *Router) Metrics() []metrics.Family {
+	router.stateMu.Lock()
+	families := metrics.Reconcile(router.status.succeeded, router.status.failures, router.status.durationSum.Seconds())
+	families = append(families, metrics.Resync(router.status.resyncs, router.status.resyncFailures, router.status.corrections)...)
+	router.stateMu.Unlock()
+
+	agentPool := router.agentPool()
+	client, err := agentPool.Get()
+	if err != nil {
+		log.Printf("ERROR: Failed to get client from pool for metrics: %v", err)
+		return append(families, metrics.Up(false))
+	}
+	defer agentPool.Put(client)
+
+	listeners, err := client.GetLocalTcpListeners(nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to get tcp listeners for metrics: %v", err)
+		return append(families, metrics.Up(false))
+	}
+	families = append(families, metrics.Up(true))
+	connectors, err := client.GetLocalTcpConnectors(nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to get tcp connectors for metrics: %v", err)
+	}
+	connections, err := client.GetLocalTcpConnections()
+	if err != nil {
+		log.Printf("ERROR: Failed to get tcp connections for metrics: %v", err)
+	} else {
+		families = append(families, metrics.TcpFlows(listeners, connectors, connections)...)
+	}
+
+	if status, err := client.GetLocalConnectorStatus(); err != nil {
+		log.Printf("ERROR: Failed to get connector status for metrics: %v", err)
+	} else {
+		families = append(families, metrics.Connectors(status)...)
+	}
+
+	families = append(families, router.networkMetrics(client)...)
+
+	if profiles, err := client.GetSslProfiles(); err != nil {
+		log.Printf("ERROR: Failed to get SSL profiles for metrics: %v", err)
+	} else {
+		families = append(families, metrics.Certificates(certs.InspectAll(profiles, time.Now(), config.GetCertExpiryWarning()))...)
+	}
+	return families
+}
+
+// networkMetrics returns the network metrics collected within the last
+// networkMetricsTTL, or collects them with client.
+func (router *Router) networkMetrics(client *qdr.Agent) []metrics.Family {
+	cache := &router.network
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.families != nil && time.Since(cache.collected) < networkMetricsTTL {
+		return cache.families
+	}
+	routers, err := client.GetAllRouters()
+	if err != nil {
+		log.Printf("ERROR: Failed to get routers for metrics: %v", err)
+		return nil
+	}
+	self, err := client.GetLocalRouter()
+	if err != nil {
+		log.Printf("ERROR: Failed to get local router for metrics: %v", err)
+		return nil
+	}
+	cache.families = metrics.Network(routers, qdr.ConnectedSitesInfo(self.Site.Id, routers))
+	cache.collected = time.Now()
+	return cache.families
+}
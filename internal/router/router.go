@@ -14,16 +14,35 @@
 package router
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/datasance/router/internal/certs"
 	"github.com/datasance/router/internal/config"
 	"github.com/datasance/router/internal/exec"
 	"github.com/datasance/router/internal/qdr"
+	"github.com/datasance/router/internal/utils"
+)
+
+const (
+	reapplyTimeout  = 2 * time.Minute
+	reapplyInterval = 2 * time.Second
+	drainInterval   = time.Second
+	// stopGrace is how long after the drain timeout the router process is
+	// stopped on shutdown if Shutdown has not stopped it
+	stopGrace = 5 * time.Second
+	// bootConfigName is the copy of the config written next to the inline SSL
+	// profile files on Kubernetes
+	bootConfigName = "skrouterd.json"
 )
 
 type Config struct {
@@ -35,229 +54,830 @@ type Config struct {
 	LogConfig   map[string]qdr.LogConfig
 	SiteConfig  *qdr.SiteConfig
 	Bridges     qdr.BridgeConfig
+	LinkRoutes  map[string]qdr.LinkRoute
+	AutoLinks   map[string]qdr.AutoLink
+	RawEntities []qdr.RawEntity
 }
 
 type Router struct {
 	Config *Config
+	// diskSslProfiles holds the profiles found under SSL_PROFILE_PATH, so they
+	// survive config updates that do not declare them
+	diskSslProfiles map[string]qdr.SslProfile
+	// mu serializes changes to the config and the running router
+	mu sync.Mutex
+	// bootConfigFile is the config file skrouterd starts from when the wrapper
+	// writes it, kept up to date with the applied config; empty on Kubernetes
+	// when it starts from the mounted file
+	bootConfigFile string
+
+	// stateMu guards the fields below, which are reported by Status without
+	// waiting for updates in progress
+	stateMu    sync.Mutex
+	supervisor *exec.Supervisor
+	agents     *qdr.AgentPool
+	// clients, if set, replaces the agent pool for applying configs
+	clients func() (managementClient, func(), error)
+	// shuttingDown is set once Shutdown starts, after which updates are refused
+	shuttingDown bool
+	status       reconcileStatus
+
+	// network caches the network metrics between scrapes
+	network networkMetricsCache
 }
 
-func (router *Router) UpdateRouter(newConfig *Config) error {
-	log.Printf("DEBUG: Starting router configuration update")
+// agentPool returns the pool of clients for the router's management listener,
+// shared by all operations on the router. It connects as configured by the
+// ROUTER_MANAGEMENT_* env.
+func (router *Router) agentPool() *qdr.AgentPool {
+	router.stateMu.Lock()
+	defer router.stateMu.Unlock()
+	if router.agents == nil {
+		router.agents = qdr.NewAgentPoolWithOptions(config.GetManagementUrl(), managementConfig(), qdr.AgentPoolOptions{
+			MaxSize:     config.GetManagementPoolSize(),
+			IdleTimeout: config.GetManagementIdleTimeout(),
+			WaitTimeout: qdr.DefaultAgentPoolOptions().WaitTimeout,
+		})
+	}
+	return router.agents
+}
+
+// managementClient is the part of qdr.Agent used to apply a config.
+type managementClient interface {
+	GetLocalRouterConfig() (*qdr.RouterConfig, error)
+	GetLocalLinkRoutes() (map[string]qdr.LinkRoute, error)
+	GetLocalAutoLinks() (map[string]qdr.AutoLink, error)
+	GetRawEntities(typenames []string) ([]qdr.RawEntity, error)
+	Begin(before *qdr.RouterConfig) transaction
+	UpdateSslProfileConfig(changes *qdr.SslProfileDifference) error
+	DeleteSslProfileConfig(changes *qdr.SslProfileDifference) error
+	ReloadSslProfile(name string) error
+	UpdateListenerConfig(changes *qdr.ListenerDifference) error
+	UpdateConnectorConfig(changes *qdr.ConnectorDifference) error
+	UpdateAddressConfig(changes *qdr.AddressDifference) error
+	UpdateLinkRouteConfig(changes *qdr.LinkRouteDifference) error
+	UpdateAutoLinkConfig(changes *qdr.AutoLinkDifference) error
+	UpdateRawEntities(changes qdr.RawEntityDifference) error
+	UpdateLogConfig(changes *qdr.LogConfigDifference) error
+	UpdateLocalBridgeConfig(changes *qdr.BridgeConfigDifference) error
+}
+
+// transaction is the part of qdr.Transaction used to apply a config.
+type transaction interface {
+	Applied() []qdr.Operation
+	Commit()
+	Rollback(cause error) *qdr.TransactionError
+}
+
+// agentClient is a managementClient backed by a qdr.Agent.
+type agentClient struct {
+	*qdr.Agent
+}
+
+func (c agentClient) Begin(before *qdr.RouterConfig) transaction {
+	return c.Agent.Begin(before)
+}
 
-	// Create agent pool and get client
-	log.Printf("DEBUG: Creating agent pool")
-	agentPool := qdr.NewAgentPool("amqp://localhost:5672", nil)
+// client returns a client for applying a config, and the func that returns
+// it once done.
+func (router *Router) client() (managementClient, func(), error) {
+	router.stateMu.Lock()
+	clients := router.clients
+	router.stateMu.Unlock()
+	if clients != nil {
+		return clients()
+	}
+	agentPool := router.agentPool()
 	client, err := agentPool.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Return client to the pool instead of closing it
+	return agentClient{client}, func() { agentPool.Put(client) }, nil
+}
+
+func managementConfig() qdr.TlsConfigRetriever {
+	sslProfile := config.GetManagementSslProfile()
+	mechanism := config.GetManagementSaslMechanism()
+	if sslProfile == "" && mechanism == "" {
+		return nil
+	}
+	username, password := config.GetManagementCredentials()
+	// Authenticates with the client certificate, if any, unless told otherwise
+	return qdr.NewManagementConfig(sslProfile, qdr.SaslConfig{
+		Mechanism: mechanism,
+		Username:  username,
+		Password:  password,
+	})
+}
+
+// routerConfig returns the qdr view of the configuration, as expected by the
+// qdr difference functions.
+func (c *Config) routerConfig() *qdr.RouterConfig {
+	return &qdr.RouterConfig{
+		Metadata:    c.Metadata,
+		SslProfiles: c.SslProfiles,
+		Listeners:   c.Listeners,
+		Connectors:  c.Connectors,
+		Addresses:   c.Addresses,
+		LogConfig:   c.LogConfig,
+		SiteConfig:  c.SiteConfig,
+		Bridges:     c.Bridges,
+		LinkRoutes:  c.LinkRoutes,
+		AutoLinks:   c.AutoLinks,
+		RawEntities: c.RawEntities,
+	}
+}
+
+func (router *Router) UpdateRouter(newConfig *Config) (err error) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if router.isShuttingDown() {
+		return fmt.Errorf("router is shutting down")
+	}
+	start := time.Now()
+	defer func() {
+		router.stateMu.Lock()
+		defer router.stateMu.Unlock()
+		router.status.updated(router.Config, err, time.Since(start))
+	}()
+	log.Printf("DEBUG: Starting router configuration update")
+	_, err = router.apply(newConfig)
+	return err
+}
+
+// Resync makes the running router match the current config again, repairing
+// drift such as entities changed with skmanage or lost when skrouterd was
+// restarted outside the supervisor. The corrections are logged and counted for
+// the metrics.
+func (router *Router) Resync() error {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	router.stateMu.Lock()
+	idle := router.shuttingDown || router.supervisor == nil || !router.supervisor.Running()
+	router.stateMu.Unlock()
+	// A router that is down is re-applied the config once it is restarted
+	if idle || router.Config == nil {
+		return nil
+	}
+	log.Printf("DEBUG: Resyncing router configuration")
+	corrections, err := router.apply(router.Config)
+	router.stateMu.Lock()
+	router.status.resynced(corrections, err)
+	router.stateMu.Unlock()
+	if err != nil {
+		log.Printf("ERROR: Router configuration resync failed: %v", err)
+		return err
+	}
+	if len(corrections) > 0 {
+		ops := make([]string, len(corrections))
+		for i, op := range corrections {
+			ops[i] = op.String()
+		}
+		log.Printf("WARN: Router had drifted from its configuration, corrected %d entities: %s", len(corrections), strings.Join(ops, ", "))
+	}
+	return nil
+}
+
+// RunResync calls Resync every interval until ctx is done. An interval of 0
+// disables it.
+func (router *Router) RunResync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = router.Resync()
+		}
+	}
+}
+
+// apply makes the router match newConfig and returns the management
+// operations that were needed. Callers hold mu.
+func (router *Router) apply(newConfig *Config) ([]qdr.Operation, error) {
+	// Profiles found on disk are part of the desired config unless it overrides them
+	for name, profile := range router.diskSslProfiles {
+		if _, ok := newConfig.SslProfiles[name]; !ok {
+			if newConfig.SslProfiles == nil {
+				newConfig.SslProfiles = make(map[string]qdr.SslProfile)
+			}
+			newConfig.SslProfiles[name] = profile
+		}
+	}
+
+	// Refuse an invalid config before touching the router or its files, so the
+	// router keeps running the last good one
+	if err := newConfig.routerConfig().Validate(); err != nil {
+		log.Printf("ERROR: Refusing router configuration update: %v", err)
+		return nil, err
+	}
+
+	if config.IsKubernetesRouterMode() && router.bootConfigFile == "" {
+		if names := newConfig.routerConfig().InlinePemSslProfiles(); len(names) > 0 {
+			log.Printf("WARN: SSL profiles %s have inline PEM, which skrouterd cannot read from the mounted config if it restarts; restart the pod to start it from a copy with the files written", strings.Join(names, ", "))
+		}
+	}
+
+	// Inline PEM replaces the files the router reads only once the update has
+	// been applied
+	stage, err := materializeSslProfiles(newConfig)
+	committed := false
+	defer func() {
+		if !committed {
+			stage.Discard()
+		}
+	}()
+	if err != nil {
+		log.Printf("ERROR: Failed to write inline SSL profiles: %v", err)
+		return nil, err
+	}
+
+	client, release, err := router.client()
 	if err != nil {
 		log.Printf("ERROR: Failed to get client from pool: %v", err)
-		return fmt.Errorf("failed to get client from pool: %v", err)
+		return nil, fmt.Errorf("failed to get client from pool: %v", err)
 	}
+	defer release()
 
-	// Get current bridge configuration
-	log.Printf("DEBUG: Getting current bridge configuration")
-	currentBridgeConfig, err := client.GetLocalBridgeConfig()
+	// Snapshot the running router, so the update can be undone if any step fails
+	log.Printf("DEBUG: Getting current router configuration")
+	current, err := client.GetLocalRouterConfig()
 	if err != nil {
-		log.Printf("ERROR: Failed to get current bridge config: %v", err)
-		return fmt.Errorf("failed to get current bridge config: %v", err)
+		log.Printf("ERROR: Failed to get current router configuration: %v", err)
+		return nil, fmt.Errorf("failed to get current router configuration: %v", err)
+	}
+	// Link routes, auto-links and raw entities are only queried when they are
+	// or were configured, so routers without them need not support the types
+	last := router.Config
+	if last == nil {
+		last = &Config{}
+	}
+	if len(last.LinkRoutes) > 0 || len(newConfig.LinkRoutes) > 0 {
+		if current.LinkRoutes, err = client.GetLocalLinkRoutes(); err != nil {
+			log.Printf("ERROR: Failed to get current link routes: %v", err)
+			return nil, fmt.Errorf("failed to get current link routes: %v", err)
+		}
+	}
+	if len(last.AutoLinks) > 0 || len(newConfig.AutoLinks) > 0 {
+		if current.AutoLinks, err = client.GetLocalAutoLinks(); err != nil {
+			log.Printf("ERROR: Failed to get current auto-links: %v", err)
+			return nil, fmt.Errorf("failed to get current auto-links: %v", err)
+		}
+	}
+	if current.RawEntities, err = client.GetRawEntities(qdr.RawEntityTypes(last.RawEntities, newConfig.RawEntities)); err != nil {
+		log.Printf("ERROR: Failed to get current raw entities: %v", err)
+		return nil, fmt.Errorf("failed to get current raw entities: %v", err)
 	}
 
-	// Calculate differences using qdr's built-in Difference method
-	log.Printf("DEBUG: Calculating bridge configuration differences")
-	changes := currentBridgeConfig.Difference(&newConfig.Bridges)
-	log.Printf("DEBUG: Bridge config changes: %+v", changes)
+	tx := client.Begin(current)
+	previous := router.Config
+	err = router.applyConfig(client, current, newConfig)
+	// A resync that corrected nothing leaves the file and the logs alone
+	changed := err == nil && (newConfig != previous || len(tx.Applied()) > 0)
+	if changed {
+		// Update the configuration file (the mounted one on Kubernetes is read-only)
+		log.Printf("DEBUG: Updating router configuration file")
+		if err = router.writeConfigFile(); err != nil {
+			err = fmt.Errorf("failed to write router configuration: %v", err)
+		}
+	}
+	if err != nil {
+		router.Config = previous
+		txErr := tx.Rollback(err)
+		log.Printf("ERROR: Router configuration update failed: %v", txErr)
+		return nil, txErr
+	}
+	tx.Commit()
+	committed = true
+	if err := stage.Commit(); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+
+	// Profiles whose files were rewritten in place are reloaded, the others
+	// were created or updated with their new paths
+	for _, name := range stage.Changed {
+		if profile, ok := current.SslProfiles[name]; ok && profile == newConfig.SslProfiles[name] && keyPairUsable(profile) {
+			if err := client.ReloadSslProfile(name); err != nil {
+				log.Printf("ERROR: Failed to reload SSL profile %s: %v", name, err)
+			}
+		}
+	}
+	removeStaleSslProfileDirs(newConfig)
+	if changed {
+		logCertificates(newConfig.SslProfiles)
+	}
+
+	log.Printf("DEBUG: Router configuration update completed successfully (%d operations)", len(tx.Applied()))
+	return tx.Applied(), nil
+}
 
-	// Update via AMQP management using qdr's built-in function
-	log.Printf("DEBUG: Updating bridge configuration")
+// applyConfig applies the difference between the current router state and
+// newConfig, then makes newConfig the in-memory config.
+func (router *Router) applyConfig(client managementClient, current *qdr.RouterConfig, newConfig *Config) error {
+	desired := newConfig.routerConfig()
+
+	// Create or update SSL profiles before the listeners and connectors that use them
+	sslProfileChanges := qdr.SslProfilesDifference(current.SslProfiles, desired)
+	log.Printf("DEBUG: SSL profile changes: %+v", sslProfileChanges)
+	// A profile whose key does not match its certificate, e.g. while only one of
+	// them has been rotated, would break the listeners and connectors using it
+	for _, profile := range append(slices.Clone(sslProfileChanges.Added), sslProfileChanges.Updated...) {
+		if err := certs.CheckKeyPair(profile); err != nil {
+			return fmt.Errorf("refusing SSL profile %s: %v", profile.Name, err)
+		}
+	}
+	if err := client.UpdateSslProfileConfig(sslProfileChanges); err != nil {
+		return fmt.Errorf("failed to update SSL profiles: %v", err)
+	}
+
+	// Reconcile listeners (inter-router, edge and normal)
+	// Never delete or replace the listener this agent is connected through
+	management := qdr.ManagementListeners(current.Listeners, config.GetManagementUrl())
+	listenerChanges := qdr.ListenersDifference(current.Listeners, newConfig.Listeners, management...)
+	log.Printf("DEBUG: Listener changes: %+v", listenerChanges)
+	if err := client.UpdateListenerConfig(listenerChanges); err != nil {
+		return fmt.Errorf("failed to update listeners: %v", err)
+	}
+
+	// Reconcile connectors (inter-router links and edge uplinks)
+	connectorChanges := qdr.ConnectorsDifference(current.Connectors, desired, nil)
+	log.Printf("DEBUG: Connector changes: %+v", connectorChanges)
+	if err := client.UpdateConnectorConfig(connectorChanges); err != nil {
+		return fmt.Errorf("failed to update connectors: %v", err)
+	}
+
+	// Reconcile address prefixes and their distribution semantics
+	addressChanges := qdr.AddressesDifference(current.Addresses, newConfig.Addresses)
+	log.Printf("DEBUG: Address changes: %+v", addressChanges)
+	if err := client.UpdateAddressConfig(addressChanges); err != nil {
+		return fmt.Errorf("failed to update addresses: %v", err)
+	}
+
+	// Reconcile link routes and auto-links to external containers, such as brokers
+	linkRouteChanges := qdr.LinkRoutesDifference(current.LinkRoutes, newConfig.LinkRoutes)
+	log.Printf("DEBUG: Link route changes: %+v", linkRouteChanges)
+	if err := client.UpdateLinkRouteConfig(linkRouteChanges); err != nil {
+		return fmt.Errorf("failed to update link routes: %v", err)
+	}
+	autoLinkChanges := qdr.AutoLinksDifference(current.AutoLinks, newConfig.AutoLinks)
+	log.Printf("DEBUG: Auto-link changes: %+v", autoLinkChanges)
+	if err := client.UpdateAutoLinkConfig(autoLinkChanges); err != nil {
+		return fmt.Errorf("failed to update auto-links: %v", err)
+	}
+
+	// Reconcile the entities of types the config model does not know
+	rawChanges := qdr.RawEntitiesDifference(current.RawEntities, newConfig.RawEntities)
+	log.Printf("DEBUG: Raw entity changes: %+v", rawChanges)
+	if err := client.UpdateRawEntities(rawChanges); err != nil {
+		return fmt.Errorf("failed to update raw entities: %v", err)
+	}
+
+	// Reconcile log levels, so they can be changed without restarting the router
+	logChanges := qdr.LogConfigsDifference(current.LogConfig, newConfig.LogConfig)
+	log.Printf("DEBUG: Log config changes: %+v", logChanges)
+	if err := client.UpdateLogConfig(logChanges); err != nil {
+		return fmt.Errorf("failed to update log configuration: %v", err)
+	}
+
+	// Calculate bridge differences using qdr's built-in Difference method
+	changes := current.Bridges.Difference(&newConfig.Bridges)
+	// Profiles still declared or used elsewhere must not be removed with the bridges
+	deletedSslProfiles := qdr.DeletedSslProfiles{}
+	for _, name := range changes.DeletedSSlProfiles {
+		if _, ok := newConfig.SslProfiles[name]; !ok && !desired.ReferencesSslProfile(name) {
+			deletedSslProfiles = append(deletedSslProfiles, name)
+		}
+	}
+	changes.DeletedSSlProfiles = deletedSslProfiles
+	log.Printf("DEBUG: Bridge config changes: %+v", changes)
 	if err := client.UpdateLocalBridgeConfig(changes); err != nil {
-		log.Printf("ERROR: Failed to update bridge config: %v", err)
 		return fmt.Errorf("failed to update bridge config: %v", err)
 	}
 
-	// Update the configuration file (skip on Kubernetes; config is read-only from ConfigMap)
-	if !config.IsKubernetesRouterMode() {
-		log.Printf("DEBUG: Updating router configuration file")
-		configJSON := router.GetRouterConfig()
-		configPath := config.GetConfigPath()
-		if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
-			log.Printf("ERROR: Failed to write router configuration: %v", err)
-			return fmt.Errorf("failed to write router configuration: %v", err)
-		}
+	// Delete SSL profiles last, once nothing on the router uses them anymore
+	if err := client.DeleteSslProfileConfig(sslProfileChanges); err != nil {
+		return fmt.Errorf("failed to delete SSL profiles: %v", err)
 	}
 
 	// Update the in-memory configuration
 	router.Config = newConfig
+	return nil
+}
 
-	// Return client to the pool instead of closing it
-	if client != nil {
-		agentPool.Put(client)
+// materializeSslProfiles stages the inline PEM content of the config's SSL
+// profiles under ROUTER_INLINE_SSL_PROFILE_PATH and points the profiles at the
+// files. The returned stage must be committed or discarded, even on error.
+func materializeSslProfiles(c *Config) (*qdr.SslProfileStage, error) {
+	stage := &qdr.SslProfileStage{}
+	dir := config.GetInlineSslProfilePath()
+	for _, name := range slices.Sorted(maps.Keys(c.SslProfiles)) {
+		profile, err := qdr.StageSslProfile(c.SslProfiles[name], dir, stage)
+		if err != nil {
+			return stage, err
+		}
+		c.SslProfiles[name] = profile
 	}
+	return stage, nil
+}
 
-	log.Printf("DEBUG: Router configuration update completed successfully")
-	return nil
+// removeStaleSslProfileDirs removes the files written for inline profiles that
+// are no longer in the config.
+func removeStaleSslProfileDirs(c *Config) {
+	dir := config.GetInlineSslProfilePath()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		profile, ok := c.SslProfiles[entry.Name()]
+		profileDir := filepath.Join(dir, entry.Name())
+		if ok && (filepath.Dir(profile.CaCertFile) == profileDir || filepath.Dir(profile.CertFile) == profileDir) {
+			continue
+		}
+		log.Printf("DEBUG: Removing files of inline SSL profile %s", entry.Name())
+		if err := os.RemoveAll(profileDir); err != nil {
+			log.Printf("ERROR: Failed to remove %s: %v", profileDir, err)
+		}
+	}
+}
+
+// logCertificates logs the SSL profiles that are invalid, expired or expire
+// within ROUTER_CERT_EXPIRY_WARNING.
+func logCertificates(profiles map[string]qdr.SslProfile) {
+	for _, report := range certs.InspectAll(profiles, time.Now(), config.GetCertExpiryWarning()) {
+		switch report.State {
+		case certs.StateInvalid:
+			log.Printf("ERROR: SSL profile %s is invalid: %s", report.Profile, strings.Join(report.Problems, "; "))
+		case certs.StateExpired:
+			log.Printf("ERROR: SSL profile %s has an expired certificate", report.Profile)
+		case certs.StateExpiring:
+			expiry, _ := report.EarliestExpiry("cert")
+			if ca, ok := report.EarliestExpiry("ca"); ok && (expiry.IsZero() || ca.Before(expiry)) {
+				expiry = ca
+			}
+			log.Printf("WARN: SSL profile %s has a certificate expiring at %s", report.Profile, expiry.Format(time.RFC3339))
+		}
+	}
+}
+
+// keyPairUsable returns false, logging why, if the certificate and key of the
+// profile cannot be loaded together, so they are not pushed to the router.
+func keyPairUsable(profile qdr.SslProfile) bool {
+	if err := certs.CheckKeyPair(profile); err != nil {
+		log.Printf("ERROR: Not applying SSL profile %s: %v", profile.Name, err)
+		return false
+	}
+	return true
+}
+
+// OnSSLProfilesAtStart records the profiles found under SSL_PROFILE_PATH when
+// it starts being watched, so their removal is handled like that of profiles
+// added later. Profiles declared by the config are left to it. They are applied
+// to the router with the next config update or resync.
+func (r *Router) OnSSLProfilesAtStart(profiles []qdr.SslProfile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.diskSslProfiles == nil {
+		r.diskSslProfiles = make(map[string]qdr.SslProfile)
+	}
+	for _, profile := range profiles {
+		if r.Config != nil {
+			if _, ok := r.Config.SslProfiles[profile.Name]; ok {
+				continue
+			}
+		}
+		r.diskSslProfiles[profile.Name] = profile
+	}
 }
 
-// OnSSLProfilesFromDisk merges profiles (from SSL_PROFILE_PATH scan) into Config.SslProfiles,
-// writes the router config file, and calls qdr ReloadSslProfile for each profile so the
-// running router picks up cert rotation without restart.
-func (r *Router) OnSSLProfilesFromDisk(profiles map[string]qdr.SslProfile) {
-	if r.Config == nil || r.Config.SslProfiles == nil {
+// OnSSLProfilesFromDisk applies the changes found under SSL_PROFILE_PATH to
+// Config.SslProfiles, writes the router config file, and makes the running router pick them
+// up without restart: new profiles are created, profiles with changed paths are updated and
+// the others are reloaded so cert rotation takes effect. Removed profiles are deleted unless
+// something still uses them, in which case they are kept and a warning is logged.
+func (r *Router) OnSSLProfilesFromDisk(changes *qdr.SslProfileDifference) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.isShuttingDown() || r.Config == nil || r.Config.SslProfiles == nil {
 		return
 	}
-	for name, profile := range profiles {
-		r.Config.SslProfiles[name] = profile
+	if r.diskSslProfiles == nil {
+		r.diskSslProfiles = make(map[string]qdr.SslProfile)
 	}
-	// Write config file only on Pot; on Kubernetes config is read-only from ConfigMap
-	if !config.IsKubernetesRouterMode() {
-		configPath := config.GetConfigPath()
-		configJSON := r.GetRouterConfig()
-		if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
-			log.Printf("ERROR: Failed to write router config after SSL profile update: %v", err)
-			return
+	var profiles []qdr.SslProfile
+	changed := make(map[string]qdr.SslProfile)
+	for _, profile := range append(slices.Clone(changes.Added), changes.Updated...) {
+		// Files may be rotated one at a time; the scan after the last one
+		// reports the profile again with the complete pair
+		if !keyPairUsable(profile) {
+			continue
+		}
+		profiles = append(profiles, profile)
+		r.Config.SslProfiles[profile.Name] = profile
+		r.diskSslProfiles[profile.Name] = profile
+		changed[profile.Name] = profile
+	}
+	var deleted []string
+	for _, name := range changes.Deleted {
+		profile, ok := r.diskSslProfiles[name]
+		current, inConfig := r.Config.SslProfiles[name]
+		if !inConfig {
+			delete(r.diskSslProfiles, name)
+			continue
+		}
+		// Profiles declared by the config itself are not the disk's to remove
+		if !ok || current != profile {
+			log.Printf("WARN: SSL profile %s was removed from %s but is declared by the config; keeping it", name, config.GetSSLProfilePath())
+			delete(r.diskSslProfiles, name)
+			continue
+		}
+		users := r.Config.routerConfig().SslProfileUsers(name)
+		if name == config.GetManagementSslProfile() {
+			users = append(users, "management connection")
+		}
+		if len(users) > 0 {
+			log.Printf("WARN: SSL profile %s was removed from %s but is still used by %s; keeping it until they no longer use it", name, config.GetSSLProfilePath(), strings.Join(users, ", "))
+			continue
 		}
+		delete(r.Config.SslProfiles, name)
+		delete(r.diskSslProfiles, name)
+		deleted = append(deleted, name)
 	}
-	agentPool := qdr.NewAgentPool("amqp://localhost:5672", nil)
+	r.stateMu.Lock()
+	r.status.sslProfiles = maps.Clone(r.Config.SslProfiles)
+	r.stateMu.Unlock()
+	logCertificates(changed)
+	if err := r.writeConfigFile(); err != nil {
+		log.Printf("ERROR: Failed to write router config after SSL profile update: %v", err)
+		return
+	}
+	agentPool := r.agentPool()
 	client, err := agentPool.Get()
 	if err != nil {
 		log.Printf("ERROR: Failed to get qdr client for SSL profile reload: %v", err)
 		return
 	}
 	defer agentPool.Put(client)
-	for name := range profiles {
-		if err := client.ReloadSslProfile(name); err != nil {
+	current, err := client.GetSslProfiles()
+	if err != nil {
+		log.Printf("ERROR: Failed to get SSL profiles from router: %v", err)
+		return
+	}
+	for _, profile := range profiles {
+		name := profile.Name
+		existing, ok := current[name]
+		if !ok {
+			if err := client.CreateSslProfile(profile); err != nil {
+				log.Printf("ERROR: Failed to create SSL profile %s: %v", name, err)
+			}
+		} else if existing != profile {
+			if err := client.UpdateSslProfile(profile); err != nil {
+				log.Printf("ERROR: Failed to update SSL profile %s: %v", name, err)
+			}
+		} else if err := client.ReloadSslProfile(name); err != nil {
 			log.Printf("ERROR: Failed to reload SSL profile %s: %v", name, err)
 		}
 	}
+	for _, name := range deleted {
+		if err := client.DeleteSslProfile(name); err != nil {
+			log.Printf("ERROR: Failed to delete SSL profile %s: %v", name, err)
+		}
+	}
 }
 
+// GetRouterConfig returns the canonical JSON for the router's config, as
+// written to QDROUTERD_CONF.
 func (router *Router) GetRouterConfig() string {
-	config := router.Config
-	configElements := [][]interface{}{}
-
-	// Add router metadata
-	configElements = append(configElements, []interface{}{
-		"router",
-		config.Metadata,
-	})
-
-	// Add SSL profiles (file paths are already absolute)
-	for _, profile := range config.SslProfiles {
-		configElements = append(configElements, []interface{}{
-			"sslProfile",
-			profile,
-		})
+	data, err := qdr.MarshalRouterConfig(*router.Config.routerConfig())
+	if err != nil {
+		log.Printf("Error marshaling router config: %v", err)
+		return ""
 	}
+	return data
+}
 
-	// Add listeners
-	for _, listener := range config.Listeners {
-		configElements = append(configElements, []interface{}{
-			"listener",
-			listener,
-		})
+// writeBootConfig writes the inline PEM of the SSL profiles to files and the
+// config file skrouterd starts from, and returns its path. On Kubernetes
+// skrouterd starts from the mounted file, unless it has inline PEM, which
+// skrouterd cannot read: it then starts from a copy pointing at the written
+// files instead. Callers hold mu.
+func (router *Router) writeBootConfig() (string, error) {
+	inline := router.Config.routerConfig().InlinePemSslProfiles()
+	stage, err := materializeSslProfiles(router.Config)
+	if err != nil {
+		stage.Discard()
+		return "", fmt.Errorf("failed to write inline SSL profiles: %v", err)
 	}
-
-	// Add connectors
-	for _, connector := range config.Connectors {
-		configElements = append(configElements, []interface{}{
-			"connector",
-			connector,
-		})
+	if err := stage.Commit(); err != nil {
+		return "", err
 	}
-
-	// Add TCP listeners
-	for _, listener := range config.Bridges.TcpListeners {
-		configElements = append(configElements, []interface{}{
-			"tcpListener",
-			listener,
-		})
+	switch {
+	case !config.IsKubernetesRouterMode():
+		router.bootConfigFile = config.GetConfigPath()
+	case len(inline) > 0:
+		router.bootConfigFile = filepath.Join(config.GetInlineSslProfilePath(), bootConfigName)
+		log.Printf("INFO: SSL profiles %s have inline PEM, starting the router from %s", strings.Join(inline, ", "), router.bootConfigFile)
+	default:
+		router.bootConfigFile = ""
+		return config.GetConfigPath(), nil
 	}
-
-	// Add TCP connectors
-	for _, connector := range config.Bridges.TcpConnectors {
-		configElements = append(configElements, []interface{}{
-			"tcpConnector",
-			connector,
-		})
+	log.Printf("DEBUG: Writing initial configuration to %s", router.bootConfigFile)
+	if err := os.MkdirAll(filepath.Dir(router.bootConfigFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create configuration directory: %v", err)
+	}
+	if err := router.writeConfigFile(); err != nil {
+		return "", fmt.Errorf("failed to write initial configuration: %v", err)
 	}
+	return router.bootConfigFile, nil
+}
 
-	// Add addresses
-	for _, address := range config.Addresses {
-		configElements = append(configElements, []interface{}{
-			"address",
-			address,
-		})
+// writeConfigFile writes the config to the file skrouterd starts from, when
+// that file is written by the wrapper rather than mounted. Callers hold mu.
+func (router *Router) writeConfigFile() error {
+	if router.bootConfigFile == "" {
+		return nil
 	}
+	return os.WriteFile(router.bootConfigFile, []byte(router.GetRouterConfig()), 0644)
+}
 
-	// Add log configs
-	for _, logConfig := range config.LogConfig {
-		configElements = append(configElements, []interface{}{
-			"log",
-			logConfig,
-		})
+// StartRouter writes the initial config (on Pot) and runs the router process
+// under a supervisor, which restarts it when it exits. The error sent on ch is
+// nil when the process was stopped, or describes why supervision gave up.
+// Shutdown stops the process once drained; ctx being done only stops it if
+// Shutdown has not done so by the end of the drain timeout.
+func (router *Router) StartRouter(ctx context.Context, ch chan<- error) {
+	log.Printf("DEBUG: Starting router with configuration")
+
+	router.mu.Lock()
+	configPath, err := router.writeBootConfig()
+	router.mu.Unlock()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		ch <- err
+		return
 	}
 
-	// Add site config if present
-	if config.SiteConfig != nil {
-		configElements = append(configElements, []interface{}{
-			"site",
-			*config.SiteConfig,
-		})
+	// Start router with QDROUTERD_CONF and QDROUTERD_CONF_TYPE so launch script uses our config file
+	env := []string{
+		fmt.Sprintf("QDROUTERD_CONF=%s", configPath),
+		"QDROUTERD_CONF_TYPE=json",
+	}
+	policy := exec.RestartPolicy{
+		InitialBackoff: config.GetRestartBackoff(),
+		MaxBackoff:     config.GetRestartMaxBackoff(),
+		MaxRestarts:    config.GetRestartLimit(),
+		Window:         config.GetRestartWindow(),
+	}
+	supervisor := exec.NewSupervisor("/home/skrouterd/bin/launch.sh", []string{}, env, policy)
+	supervisor.OnRestart = func(restarts int) {
+		router.reapplyConfig(ctx, restarts)
 	}
+	router.stateMu.Lock()
+	if router.shuttingDown {
+		router.stateMu.Unlock()
+		ch <- nil
+		return
+	}
+	router.supervisor = supervisor
+	// The router starts from the config file, so it is applied from the start
+	router.status.applied(router.Config)
+	router.stateMu.Unlock()
 
-	// Marshal to JSON
-	data, err := json.MarshalIndent(configElements, "", "    ")
+	log.Printf("DEBUG: Starting router process")
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(config.GetDrainTimeout()+stopGrace, cancel)
+	})
+	defer stop()
+	status, err := supervisor.Run(runCtx)
 	if err != nil {
-		log.Printf("Error marshaling router config: %v", err)
-		return ""
+		log.Printf("ERROR: Router process supervision ended: %v", err)
+		ch <- fmt.Errorf("router process exited with error: %v", err)
+		return
 	}
+	log.Printf("DEBUG: Router process stopped: %s", status)
+	ch <- nil
+}
 
-	return string(data)
+// reapplyConfig makes a restarted router match the current config, as changes
+// applied over management since the config file was written would be lost.
+// It gives up once ctx is done or the router is shutting down.
+func (router *Router) reapplyConfig(ctx context.Context, restarts int) {
+	log.Printf("DEBUG: Router process restarted (%d), re-applying configuration", restarts)
+	// Connections to the previous process are broken
+	router.agentPool().CloseIdle()
+	retryCtx, cancel := context.WithTimeout(ctx, reapplyTimeout)
+	defer cancel()
+	err := utils.RetryWithContext(retryCtx, reapplyInterval, func() (bool, error) {
+		// The config is not applied once shutdown has begun, so stop trying
+		if router.isShuttingDown() {
+			log.Printf("DEBUG: Router shutting down, not re-applying configuration")
+			return true, nil
+		}
+		router.mu.Lock()
+		current := router.Config
+		router.mu.Unlock()
+		if err := router.UpdateRouter(current); err != nil {
+			log.Printf("DEBUG: Router not ready for configuration yet: %v", err)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("ERROR: Failed to re-apply configuration after router restart: %v", err)
+	}
 }
 
-func (router *Router) StartRouter(ch chan<- error) {
-	log.Printf("DEBUG: Starting router with configuration")
+func (router *Router) isShuttingDown() bool {
+	router.stateMu.Lock()
+	defer router.stateMu.Unlock()
+	return router.shuttingDown
+}
 
-	configPath := config.GetConfigPath()
-	// On Pot we create and write initial config; on Kubernetes config is already mounted at QDROUTERD_CONF
-	if !config.IsKubernetesRouterMode() {
-		log.Printf("DEBUG: Creating initial router configuration")
-		configJSON := router.GetRouterConfig()
+// Shutdown stops new tcp flows from arriving by deleting the tcpListeners,
+// waits up to drainTimeout for the existing flows to finish and then sends
+// SIGTERM to the router process. StartRouter reports on its channel once the
+// process has exited. Config updates are refused from the start of Shutdown,
+// and one in progress is waited for, so it cannot recreate the tcpListeners.
+func (router *Router) Shutdown(drainTimeout time.Duration) {
+	router.stateMu.Lock()
+	router.shuttingDown = true
+	supervisor := router.supervisor
+	router.stateMu.Unlock()
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if supervisor == nil {
+		return
+	}
+	if drainTimeout > 0 && supervisor.Running() {
+		router.drain(drainTimeout)
+	}
+	router.agentPool().CloseIdle()
+	log.Printf("DEBUG: Stopping router process")
+	if err := supervisor.Stop(syscall.SIGTERM); err != nil {
+		// Waiting to be restarted, which Stop has prevented
+		log.Printf("DEBUG: %v", err)
+	}
+}
 
-		log.Printf("DEBUG: Ensuring configuration directory exists")
-		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
-			log.Printf("ERROR: Failed to create configuration directory: %v", err)
-			ch <- fmt.Errorf("failed to create configuration directory: %v", err)
-			return
+func (router *Router) drain(timeout time.Duration) {
+	log.Printf("DEBUG: Draining router for up to %s", timeout)
+	agentPool := router.agentPool()
+	client, err := agentPool.Get()
+	if err != nil {
+		log.Printf("ERROR: Failed to get client from pool, skipping drain: %v", err)
+		return
+	}
+	defer agentPool.Put(client)
+
+	listeners, err := client.GetLocalTcpListeners(nil)
+	if err != nil {
+		log.Printf("ERROR: Failed to get tcp listeners, skipping drain: %v", err)
+		return
+	}
+	for _, listener := range listeners {
+		if err := client.Delete("io.skupper.router.tcpListener", listener.Name); err != nil {
+			log.Printf("ERROR: Failed to delete tcp listener %s: %v", listener.Name, err)
 		}
+	}
 
-		log.Printf("DEBUG: Writing initial configuration to %s", configPath)
-		if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
-			log.Printf("ERROR: Failed to write initial configuration: %v", err)
-			ch <- fmt.Errorf("failed to write initial configuration: %v", err)
-			return
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = utils.RetryWithContext(ctx, drainInterval, func() (bool, error) {
+		connections, err := client.GetLocalTcpConnections()
+		if err != nil {
+			return false, err
 		}
+		if len(connections) > 0 {
+			log.Printf("DEBUG: Waiting for %d tcp flows to finish", len(connections))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		log.Printf("ERROR: Router not drained: %v", err)
+		return
 	}
+	log.Printf("DEBUG: Router drained")
+}
 
-	// Start router with QDROUTERD_CONF and QDROUTERD_CONF_TYPE so launch script uses our config file
-	env := []string{
-		fmt.Sprintf("QDROUTERD_CONF=%s", configPath),
-		"QDROUTERD_CONF_TYPE=json",
+// ExitCode returns the exit code of the router process, to be used as the exit
+// code of the wrapper, or 0 if it has not exited.
+func (router *Router) ExitCode() int {
+	router.stateMu.Lock()
+	supervisor := router.supervisor
+	router.stateMu.Unlock()
+	if supervisor == nil || supervisor.LastExit() == nil {
+		return 0
 	}
-	exitChannel := make(chan error)
-	log.Printf("DEBUG: Starting router process")
-	go exec.Run(ch, "/home/skrouterd/bin/launch.sh", []string{}, env)
-
-	// Monitor for configuration updates
-	go func() {
-		for {
-			select {
-			case err := <-exitChannel:
-				log.Printf("ERROR: Router process exited with error: %v", err)
-				ch <- fmt.Errorf("router process exited with error: %v", err)
-				return
-			default:
-				// Check for configuration updates from ioFog-agent
-				time.Sleep(5 * time.Second)
-			}
-		}
-	}()
+	return supervisor.LastExit().ExitCode()
 }
@@ -0,0 +1,369 @@
+package router
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/qdr"
+	"github.com/datasance/router/internal/resources/types"
+)
+
+// testCaPem returns a self-signed CA certificate in PEM.
+func testCaPem(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ca"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestWriteBootConfigKubernetesInlinePem(t *testing.T) {
+	inlineDir := t.TempDir()
+	mounted := filepath.Join(t.TempDir(), "skrouterd.json")
+	t.Setenv(types.ENV_PLATFORM, string(types.PlatformKubernetes))
+	t.Setenv(types.EnvInlineSslProfilePath, inlineDir)
+	t.Setenv(types.TransportEnvConfig, mounted)
+
+	// Without inline PEM skrouterd starts from the mounted file
+	router := &Router{Config: &Config{SslProfiles: map[string]qdr.SslProfile{}}}
+	if path, err := router.writeBootConfig(); err != nil || path != mounted {
+		t.Fatalf("writeBootConfig() = %q, %v, want the mounted file", path, err)
+	}
+
+	ca := testCaPem(t)
+	router = &Router{Config: &Config{SslProfiles: map[string]qdr.SslProfile{
+		"broker": {Name: "broker", CaCert: ca},
+	}}}
+	path, err := router.writeBootConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(inlineDir, bootConfigName) {
+		t.Errorf("writeBootConfig() = %q, want a copy in the inline profile dir", path)
+	}
+	profile := router.Config.SslProfiles["broker"]
+	if profile.HasInlinePem() || profile.CaCertFile != filepath.Join(inlineDir, "broker", "ca.crt") {
+		t.Errorf("profile = %+v, want inline PEM written to files", profile)
+	}
+	if data, err := os.ReadFile(profile.CaCertFile); err != nil || string(data) != ca {
+		t.Errorf("ca.crt = %q, %v", data, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), profile.CaCertFile) || strings.Contains(string(data), "BEGIN CERTIFICATE") {
+		t.Errorf("boot config does not point at the written files:\n%s", data)
+	}
+	if _, err := os.Stat(mounted); !os.IsNotExist(err) {
+		t.Errorf("mounted config was written: %v", err)
+	}
+
+	// Later updates keep the copy current, and the stale profile dirs cleanup leaves it alone
+	router.Config.SslProfiles = map[string]qdr.SslProfile{}
+	removeStaleSslProfileDirs(router.Config)
+	if err := router.writeConfigFile(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || strings.Contains(string(data), "broker") {
+		t.Errorf("boot config = %q, %v, want the profile removed", data, err)
+	}
+}
+
+func TestSSLProfileAtStartRemoved(t *testing.T) {
+	// Nothing answers management, so only the config is checked
+	t.Setenv(types.EnvManagementUrl, "amqp://127.0.0.1:1")
+	disk := qdr.SslProfile{Name: "disk", CaCertFile: "/etc/skupper-router-certs/disk/ca.crt"}
+	declared := qdr.SslProfile{Name: "declared", CaCertFile: "/etc/skupper-router-certs/declared/ca.crt"}
+	router := &Router{Config: &Config{SslProfiles: map[string]qdr.SslProfile{"declared": declared}}}
+	router.OnSSLProfilesAtStart([]qdr.SslProfile{disk, declared})
+	if _, ok := router.diskSslProfiles["declared"]; ok || router.diskSslProfiles["disk"] != disk {
+		t.Fatalf("diskSslProfiles = %v, want only disk", router.diskSslProfiles)
+	}
+
+	// As merged into the config by the next update
+	router.Config.SslProfiles["disk"] = disk
+	router.OnSSLProfilesFromDisk(&qdr.SslProfileDifference{Deleted: []string{"disk", "declared"}})
+	if _, ok := router.Config.SslProfiles["disk"]; ok {
+		t.Errorf("profile removed from disk is still in the config")
+	}
+	if _, ok := router.diskSslProfiles["disk"]; ok {
+		t.Errorf("profile removed from disk is still recorded")
+	}
+	if _, ok := router.Config.SslProfiles["declared"]; !ok {
+		t.Errorf("profile declared by the config was removed")
+	}
+}
+
+func TestStatusReportsResyncError(t *testing.T) {
+	router := &Router{}
+	router.status.resynced(nil, errors.New("failed to get current router configuration"))
+	status := router.Status()
+	if status.LastResyncError != "failed to get current router configuration" || status.LastResyncErrorAt == nil {
+		t.Errorf("Status() = %+v, want the resync error", status)
+	}
+	if status.LastResyncAt != nil || status.LastError != "" {
+		t.Errorf("Status() = %+v, want only the resync error", status)
+	}
+
+	router.status.resynced(nil, nil)
+	if status := router.Status(); status.LastResyncAt == nil || status.LastResyncError == "" {
+		t.Errorf("Status() = %+v, want the resync and the last resync error", status)
+	}
+}
+
+// fakeAgent is a management client for a router whose state is held in a
+// RouterConfig. The update named by fail is refused, and rolling back its
+// transactions undoes the updates applied so far.
+type fakeAgent struct {
+	state   *qdr.RouterConfig
+	fail    string
+	applied []qdr.Operation
+	undo    []func()
+	// clients counts the times the fake was handed out
+	clients int
+}
+
+func newFakeAgent(state *qdr.RouterConfig) *fakeAgent {
+	return &fakeAgent{state: state}
+}
+
+func (f *fakeAgent) router(c *Config) *Router {
+	return &Router{Config: c, clients: func() (managementClient, func(), error) {
+		f.clients++
+		return f, func() {}, nil
+	}}
+}
+
+// update records the update of the entities of typename, which apply makes
+// to the state, returning how to undo it.
+func (f *fakeAgent) update(typename string, empty bool, apply func() func()) error {
+	if empty {
+		return nil
+	}
+	if typename == f.fail {
+		return fmt.Errorf("%s refused", typename)
+	}
+	f.applied = append(f.applied, qdr.Operation{Operation: "UPDATE", Type: typename})
+	if apply != nil {
+		f.undo = append(f.undo, apply())
+	}
+	return nil
+}
+
+func (f *fakeAgent) GetLocalRouterConfig() (*qdr.RouterConfig, error) {
+	return &qdr.RouterConfig{
+		SslProfiles: maps.Clone(f.state.SslProfiles),
+		Listeners:   maps.Clone(f.state.Listeners),
+		Connectors:  maps.Clone(f.state.Connectors),
+		Addresses:   maps.Clone(f.state.Addresses),
+		LogConfig:   maps.Clone(f.state.LogConfig),
+	}, nil
+}
+
+func (f *fakeAgent) GetLocalLinkRoutes() (map[string]qdr.LinkRoute, error) {
+	return nil, nil
+}
+
+func (f *fakeAgent) GetLocalAutoLinks() (map[string]qdr.AutoLink, error) {
+	return nil, nil
+}
+
+func (f *fakeAgent) GetRawEntities(typenames []string) ([]qdr.RawEntity, error) {
+	return nil, nil
+}
+
+func (f *fakeAgent) Begin(before *qdr.RouterConfig) transaction {
+	f.applied = nil
+	f.undo = nil
+	return f
+}
+
+func (f *fakeAgent) Applied() []qdr.Operation {
+	return f.applied
+}
+
+func (f *fakeAgent) Commit() {}
+
+func (f *fakeAgent) Rollback(cause error) *qdr.TransactionError {
+	for i := len(f.undo) - 1; i >= 0; i-- {
+		f.undo[i]()
+	}
+	return &qdr.TransactionError{Err: cause, Applied: f.applied}
+}
+
+func (f *fakeAgent) UpdateSslProfileConfig(changes *qdr.SslProfileDifference) error {
+	return f.update("sslProfile", len(changes.Added)+len(changes.Updated) == 0, func() func() {
+		before := maps.Clone(f.state.SslProfiles)
+		for _, profile := range append(changes.Added, changes.Updated...) {
+			f.state.SslProfiles[profile.Name] = profile
+		}
+		return func() { f.state.SslProfiles = before }
+	})
+}
+
+func (f *fakeAgent) DeleteSslProfileConfig(changes *qdr.SslProfileDifference) error {
+	return f.update("sslProfile", len(changes.Deleted) == 0, func() func() {
+		before := maps.Clone(f.state.SslProfiles)
+		for _, name := range changes.Deleted {
+			delete(f.state.SslProfiles, name)
+		}
+		return func() { f.state.SslProfiles = before }
+	})
+}
+
+func (f *fakeAgent) ReloadSslProfile(name string) error {
+	return nil
+}
+
+func (f *fakeAgent) UpdateListenerConfig(changes *qdr.ListenerDifference) error {
+	return f.update("listener", changes.Empty(), func() func() {
+		before := maps.Clone(f.state.Listeners)
+		for _, l := range changes.Deleted {
+			delete(f.state.Listeners, l.Name)
+		}
+		for _, l := range changes.Added {
+			f.state.Listeners[l.Name] = l
+		}
+		return func() { f.state.Listeners = before }
+	})
+}
+
+func (f *fakeAgent) UpdateConnectorConfig(changes *qdr.ConnectorDifference) error {
+	return f.update("connector", changes.Empty(), func() func() {
+		before := maps.Clone(f.state.Connectors)
+		for _, c := range changes.Deleted {
+			delete(f.state.Connectors, c.Name)
+		}
+		for _, c := range changes.Added {
+			f.state.Connectors[c.Name] = c
+		}
+		return func() { f.state.Connectors = before }
+	})
+}
+
+func (f *fakeAgent) UpdateAddressConfig(changes *qdr.AddressDifference) error {
+	return f.update("address", changes.Empty(), nil)
+}
+
+func (f *fakeAgent) UpdateLinkRouteConfig(changes *qdr.LinkRouteDifference) error {
+	return f.update("linkRoute", changes.Empty(), nil)
+}
+
+func (f *fakeAgent) UpdateAutoLinkConfig(changes *qdr.AutoLinkDifference) error {
+	return f.update("autoLink", changes.Empty(), nil)
+}
+
+func (f *fakeAgent) UpdateRawEntities(changes qdr.RawEntityDifference) error {
+	return f.update("raw", changes.Empty(), nil)
+}
+
+func (f *fakeAgent) UpdateLogConfig(changes *qdr.LogConfigDifference) error {
+	return f.update("log", changes.Empty(), nil)
+}
+
+func (f *fakeAgent) UpdateLocalBridgeConfig(changes *qdr.BridgeConfigDifference) error {
+	return f.update("bridge", changes.Empty(), nil)
+}
+
+func TestApplyRollsBackPartialUpdate(t *testing.T) {
+	inlineDir := t.TempDir()
+	t.Setenv(types.EnvInlineSslProfilePath, inlineDir)
+	amqp := qdr.Listener{Name: "amqp", Port: 5672}
+	agent := newFakeAgent(&qdr.RouterConfig{
+		SslProfiles: map[string]qdr.SslProfile{},
+		Listeners:   map[string]qdr.Listener{"amqp": amqp},
+		Connectors:  map[string]qdr.Connector{},
+	})
+	previous := &Config{Listeners: map[string]qdr.Listener{"amqp": amqp}}
+	router := agent.router(previous)
+
+	// The connector fails after the SSL profile and listener using it were created
+	agent.fail = "connector"
+	newConfig := func() *Config {
+		return &Config{
+			SslProfiles: map[string]qdr.SslProfile{"broker": {Name: "broker", CaCert: testCaPem(t)}},
+			Listeners: map[string]qdr.Listener{
+				"amqp":  amqp,
+				"amqps": {Name: "amqps", Port: 5671, SslProfile: "broker"},
+			},
+			Connectors: map[string]qdr.Connector{"uplink": {Name: "uplink", Host: "interior", Port: "45671", SslProfile: "broker"}},
+		}
+	}
+	_, err := router.apply(newConfig())
+	var txErr *qdr.TransactionError
+	if !errors.As(err, &txErr) || len(txErr.Applied) != 2 {
+		t.Fatalf("apply() = %v, want a TransactionError after 2 updates", err)
+	}
+	if len(agent.state.SslProfiles) != 0 || len(agent.state.Listeners) != 1 || len(agent.state.Connectors) != 0 {
+		t.Errorf("router state = %+v, want the updates rolled back", agent.state)
+	}
+	if router.Config != previous {
+		t.Errorf("Config = %+v, want the previous config", router.Config)
+	}
+	if _, err := os.Stat(filepath.Join(inlineDir, "broker", "ca.crt")); !os.IsNotExist(err) {
+		t.Errorf("inline PEM of the failed update was written: %v", err)
+	}
+
+	// Once the connector is accepted the whole update is applied
+	agent.fail = ""
+	ops, err := router.apply(newConfig())
+	if err != nil || len(ops) != 3 {
+		t.Fatalf("apply() = %v, %v, want 3 updates", ops, err)
+	}
+	if _, ok := agent.state.Connectors["uplink"]; !ok || len(agent.state.Listeners) != 2 {
+		t.Errorf("router state = %+v, want the update applied", agent.state)
+	}
+	if _, err := os.Stat(filepath.Join(inlineDir, "broker", "ca.crt")); err != nil {
+		t.Errorf("inline PEM was not written: %v", err)
+	}
+}
+
+func TestReapplySkippedWhileShuttingDown(t *testing.T) {
+	agent := newFakeAgent(&qdr.RouterConfig{})
+	router := agent.router(&Config{})
+	router.shuttingDown = true
+
+	if err := router.UpdateRouter(&Config{}); err == nil {
+		t.Errorf("UpdateRouter() succeeded while shutting down")
+	}
+	done := make(chan struct{})
+	go func() {
+		router.reapplyConfig(context.Background(), 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(reapplyInterval + 5*time.Second):
+		t.Fatal("reapplyConfig() kept retrying while shutting down")
+	}
+	if agent.clients != 0 {
+		t.Errorf("config applied %d times while shutting down", agent.clients)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2023 Datasance Teknoloji A.S.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/datasance/router/internal/certs"
+	"github.com/datasance/router/internal/config"
+	"github.com/datasance/router/internal/qdr"
+)
+
+// Status describes the router process and the last reconciliation of its config.
+type Status struct {
+	Running      bool   `json:"running"`
+	Restarts     int    `json:"restarts"`
+	LastExit     string `json:"lastExit,omitempty"`
+	ShuttingDown bool   `json:"shuttingDown"`
+	// ConfigHash identifies the config last applied to the router
+	ConfigHash      string     `json:"configHash,omitempty"`
+	ConfigAppliedAt *time.Time `json:"configAppliedAt,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	LastErrorAt     *time.Time `json:"lastErrorAt,omitempty"`
+	// LastResyncAt is when the router was last found to match the config
+	LastResyncAt      *time.Time `json:"lastResyncAt,omitempty"`
+	LastResyncError   string     `json:"lastResyncError,omitempty"`
+	LastResyncErrorAt *time.Time `json:"lastResyncErrorAt,omitempty"`
+	// Certificates reports the state of the SSL profiles of that config
+	Certificates []certs.Report `json:"certificates,omitempty"`
+}
+
+// Reconciled returns true if the last attempt to apply a config succeeded.
+func (s Status) Reconciled() bool {
+	if s.ConfigAppliedAt == nil {
+		return false
+	}
+	return s.LastErrorAt == nil || s.ConfigAppliedAt.After(*s.LastErrorAt)
+}
+
+type reconcileStatus struct {
+	configHash string
+	appliedAt  time.Time
+	lastError  error
+	lastErrAt  time.Time
+	// SSL profiles of the applied config, inspected for the status
+	sslProfiles map[string]qdr.SslProfile
+	// Counts and total duration of the updates, for metrics
+	succeeded   int
+	failures    int
+	durationSum time.Duration
+	// Counts of the periodic resyncs and of the entities they corrected, by type
+	resyncs        int
+	resyncFailures int
+	corrections    map[string]int
+	resyncedAt     time.Time
+	resyncError    error
+	resyncErrAt    time.Time
+}
+
+func (s *reconcileStatus) applied(c *Config) {
+	s.configHash = configHash(c)
+	s.appliedAt = time.Now()
+	s.sslProfiles = maps.Clone(c.SslProfiles)
+}
+
+func (s *reconcileStatus) failed(err error) {
+	s.lastError = err
+	s.lastErrAt = time.Now()
+}
+
+func (s *reconcileStatus) updated(c *Config, err error, duration time.Duration) {
+	s.durationSum += duration
+	if err != nil {
+		s.failures++
+		s.failed(err)
+		return
+	}
+	s.succeeded++
+	s.applied(c)
+}
+
+func (s *reconcileStatus) resynced(corrections []qdr.Operation, err error) {
+	if err != nil {
+		s.resyncFailures++
+		s.resyncError = err
+		s.resyncErrAt = time.Now()
+		return
+	}
+	s.resyncs++
+	s.resyncedAt = time.Now()
+	if s.corrections == nil {
+		s.corrections = make(map[string]int)
+	}
+	for _, op := range corrections {
+		// io.skupper.router.router.config.address is counted as address
+		s.corrections[op.Type[strings.LastIndex(op.Type, ".")+1:]]++
+	}
+}
+
+// configHash returns a hash of the config, which is stable as encoding/json
+// sorts map keys.
+func configHash(c *Config) string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ConfigRejected records a config that was not applied because it could not
+// be parsed, so the router reports not ready until a config is applied.
+func (router *Router) ConfigRejected(err error) {
+	router.stateMu.Lock()
+	defer router.stateMu.Unlock()
+	router.status.failed(err)
+}
+
+// Status returns the current status of the router.
+func (router *Router) Status() Status {
+	router.stateMu.Lock()
+	defer router.stateMu.Unlock()
+	status := Status{
+		ShuttingDown: router.shuttingDown,
+		ConfigHash:   router.status.configHash,
+	}
+	if router.supervisor != nil {
+		status.Running = router.supervisor.Running()
+		status.Restarts = router.supervisor.Restarts()
+		if exit := router.supervisor.LastExit(); exit != nil {
+			status.LastExit = exit.String()
+		}
+	}
+	if !router.status.appliedAt.IsZero() {
+		appliedAt := router.status.appliedAt
+		status.ConfigAppliedAt = &appliedAt
+	}
+	if router.status.lastError != nil {
+		lastErrAt := router.status.lastErrAt
+		status.LastError = router.status.lastError.Error()
+		status.LastErrorAt = &lastErrAt
+	}
+	if !router.status.resyncedAt.IsZero() {
+		resyncedAt := router.status.resyncedAt
+		status.LastResyncAt = &resyncedAt
+	}
+	if router.status.resyncError != nil {
+		resyncErrAt := router.status.resyncErrAt
+		status.LastResyncError = router.status.resyncError.Error()
+		status.LastResyncErrorAt = &resyncErrAt
+	}
+	status.Certificates = certs.InspectAll(router.status.sslProfiles, time.Now(), config.GetCertExpiryWarning())
+	return status
+}
+
+// CheckManagement returns an error if the router does not answer a management
+// query.
+func (router *Router) CheckManagement() error {
+	agentPool := router.agentPool()
+	client, err := agentPool.Get()
+	if err != nil {
+		return fmt.Errorf("failed to connect to router: %v", err)
+	}
+	defer agentPool.Put(client)
+	if _, err := client.Query("io.skupper.router.router", []string{"id"}); err != nil {
+		return fmt.Errorf("router management query failed: %v", err)
+	}
+	return nil
+}
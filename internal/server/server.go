@@ -0,0 +1,160 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2023 Datasance Teknoloji A.S.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/datasance/router/internal/metrics"
+	"github.com/datasance/router/internal/router"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// StatusProvider is implemented by router.Router.
+type StatusProvider interface {
+	Status() router.Status
+	CheckManagement() error
+	Metrics() []metrics.Family
+}
+
+// Server serves the health, readiness and status of the router over HTTP:
+//
+//	/healthz  200 while the router process is running
+//	/readyz   200 once the router answers management queries and the last
+//	          config was applied, 503 with the reason otherwise
+//	/status   the router status as JSON
+//	/metrics  the router metrics in the Prometheus text format
+type Server struct {
+	address string
+	router  StatusProvider
+	mux     *http.ServeMux
+}
+
+type statusResponse struct {
+	router.Status
+	Management string `json:"management"`
+	Ready      bool   `json:"ready"`
+}
+
+func NewServer(address string, provider StatusProvider) *Server {
+	s := &Server{
+		address: address,
+		router:  provider,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/healthz", s.healthz)
+	s.mux.HandleFunc("/readyz", s.readyz)
+	s.mux.HandleFunc("/status", s.status)
+	s.mux.HandleFunc("/metrics", s.metrics)
+	return s
+}
+
+// Handler returns the handler serving the endpoints.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Run serves the endpoints until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.address,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("DEBUG: Serving router status on %s", s.address)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("status server failed: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	if !s.router.Status().Running {
+		http.Error(w, "router process is not running", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// notReady returns why the router is not ready, or "" if it is.
+func (s *Server) notReady(status router.Status, management error) string {
+	switch {
+	case status.ShuttingDown:
+		return "router is shutting down"
+	case !status.Running:
+		return "router process is not running"
+	case management != nil:
+		return management.Error()
+	case !status.Reconciled():
+		if status.LastError != "" {
+			return fmt.Sprintf("config not applied: %s", status.LastError)
+		}
+		return "config not applied"
+	}
+	return ""
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	status := s.router.Status()
+	var management error
+	if status.Running {
+		management = s.router.CheckManagement()
+	}
+	if reason := s.notReady(status, management); reason != "" {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	response := statusResponse{
+		Status:     s.router.Status(),
+		Management: "ok",
+	}
+	var management error
+	if response.Running {
+		management = s.router.CheckManagement()
+	} else {
+		management = errors.New("router process is not running")
+	}
+	if management != nil {
+		response.Management = management.Error()
+	}
+	response.Ready = s.notReady(response.Status, management) == ""
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("ERROR: Failed to write status response: %v", err)
+	}
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Write(w, s.router.Metrics()); err != nil {
+		log.Printf("ERROR: Failed to write metrics response: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/metrics"
+	"github.com/datasance/router/internal/router"
+)
+
+type fakeRouter struct {
+	status     router.Status
+	management error
+}
+
+func (f *fakeRouter) Status() router.Status {
+	return f.status
+}
+
+func (f *fakeRouter) CheckManagement() error {
+	return f.management
+}
+
+func (f *fakeRouter) Metrics() []metrics.Family {
+	return []metrics.Family{metrics.Up(f.management == nil)}
+}
+
+func get(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	applied := time.Now()
+	failed := applied.Add(time.Second)
+	tests := []struct {
+		name    string
+		router  fakeRouter
+		healthy bool
+		ready   bool
+		reason  string
+	}{
+		{
+			name:   "not started",
+			reason: "not running",
+		},
+		{
+			name:    "config not applied",
+			router:  fakeRouter{status: router.Status{Running: true}},
+			healthy: true,
+			reason:  "config not applied",
+		},
+		{
+			name:    "ready",
+			router:  fakeRouter{status: router.Status{Running: true, ConfigAppliedAt: &applied}},
+			healthy: true,
+			ready:   true,
+		},
+		{
+			name:    "management unavailable",
+			router:  fakeRouter{status: router.Status{Running: true, ConfigAppliedAt: &applied}, management: errors.New("connection refused")},
+			healthy: true,
+			reason:  "connection refused",
+		},
+		{
+			name: "last update failed",
+			router: fakeRouter{status: router.Status{
+				Running:         true,
+				ConfigAppliedAt: &applied,
+				LastError:       "failed to update listeners",
+				LastErrorAt:     &failed,
+			}},
+			healthy: true,
+			reason:  "failed to update listeners",
+		},
+		{
+			name:    "shutting down",
+			router:  fakeRouter{status: router.Status{Running: true, ShuttingDown: true, ConfigAppliedAt: &applied}},
+			healthy: true,
+			reason:  "shutting down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", &tt.router)
+			if w := get(t, s, "/healthz"); (w.Code == http.StatusOK) != tt.healthy {
+				t.Errorf("/healthz = %d, want healthy %v", w.Code, tt.healthy)
+			}
+			w := get(t, s, "/readyz")
+			if (w.Code == http.StatusOK) != tt.ready {
+				t.Errorf("/readyz = %d, want ready %v", w.Code, tt.ready)
+			}
+			if !tt.ready && !strings.Contains(w.Body.String(), tt.reason) {
+				t.Errorf("/readyz body = %q, want reason %q", w.Body.String(), tt.reason)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	applied := time.Now()
+	s := NewServer(":0", &fakeRouter{
+		status: router.Status{
+			Running:         true,
+			Restarts:        2,
+			ConfigHash:      "abc",
+			ConfigAppliedAt: &applied,
+		},
+		management: errors.New("timeout"),
+	})
+	w := get(t, s, "/status")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/status = %d", w.Code)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response["running"] != true || response["restarts"] != float64(2) || response["configHash"] != "abc" {
+		t.Errorf("unexpected status %v", response)
+	}
+	if response["management"] != "timeout" || response["ready"] != false {
+		t.Errorf("management = %v, ready = %v, want timeout and not ready", response["management"], response["ready"])
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := NewServer(":0", &fakeRouter{})
+	w := get(t, s, "/metrics")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics = %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "skrouter_up 1\n") {
+		t.Errorf("body = %q, want skrouter_up 1", w.Body.String())
+	}
+}
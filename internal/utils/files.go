@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 type FilenameFilter func(string) bool
@@ -41,3 +43,53 @@ func (f *DirectoryReader) ReadDir(dirname string, filter FilenameFilter) ([]stri
 	}
 	return fileNames, nil
 }
+
+// WriteFileAtomic writes data to filename with the given permissions, through a
+// temporary file renamed over it, so readers never see a partly written file.
+// Nothing is written if the file already has the same content and permissions.
+// It returns true if the file was written.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) (bool, error) {
+	tmp, err := StageFile(filename, data, perm)
+	if err != nil || tmp == "" {
+		return false, err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// StageFile writes data with the given permissions to a temporary file next to
+// filename and returns its name, so it can later be renamed over filename. It
+// returns "" if filename already has the same content and permissions.
+func StageFile(filename string, data []byte, perm os.FileMode) (string, error) {
+	if info, err := os.Stat(filename); err == nil && info.Mode().Perm() == perm {
+		if current, err := os.ReadFile(filename); err == nil && bytes.Equal(current, data) {
+			return "", nil
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	fail := func(err error) (string, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -106,3 +106,30 @@ func TestDirectoryReader(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "tls.key")
+
+	written, err := WriteFileAtomic(filename, []byte("key"), 0600)
+	assert.NilError(t, err)
+	assert.Assert(t, written)
+	info, err := os.Stat(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+	written, err = WriteFileAtomic(filename, []byte("key"), 0600)
+	assert.NilError(t, err)
+	assert.Assert(t, !written, "unchanged content should not be written")
+
+	written, err = WriteFileAtomic(filename, []byte("new key"), 0600)
+	assert.NilError(t, err)
+	assert.Assert(t, written)
+	data, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "new key")
+
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1, "temporary files should be removed")
+}
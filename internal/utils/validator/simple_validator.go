@@ -3,6 +3,7 @@ package validator
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -101,6 +102,44 @@ func (i NumberValidator) Evaluate(value interface{}) (bool, error) {
 	return true, nil
 }
 
+//
+
+type PortValidator struct {
+	Min int
+	Max int
+}
+
+func NewPortValidator() *PortValidator {
+	return &PortValidator{
+		Min: 1,
+		Max: 65535,
+	}
+}
+
+// Evaluate accepts a port given as an integer or as a numeric string.
+func (p PortValidator) Evaluate(value interface{}) (bool, error) {
+	var port int
+	switch v := value.(type) {
+	case int:
+		port = v
+	case int32:
+		port = int(v)
+	case string:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return false, fmt.Errorf("port %q is not a number", v)
+		}
+		port = i
+	default:
+		return false, fmt.Errorf("value is not a port")
+	}
+
+	if port < p.Min || port > p.Max {
+		return false, fmt.Errorf("port %d is not between %d and %d", port, p.Min, p.Max)
+	}
+	return true, nil
+}
+
 ///
 
 type OptionValidator struct {
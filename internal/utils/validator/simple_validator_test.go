@@ -85,6 +85,36 @@ func TestIntegerValidator_Evaluate(t *testing.T) {
 	}
 }
 
+func TestPortValidator_Evaluate(t *testing.T) {
+	type test struct {
+		name   string
+		value  interface{}
+		result bool
+	}
+
+	testTable := []test{
+		{name: "valid int", value: 5672, result: true},
+		{name: "valid int32", value: int32(45671), result: true},
+		{name: "valid string", value: "8080", result: true},
+		{name: "zero", value: 0, result: false},
+		{name: "too large", value: "65536", result: false},
+		{name: "empty string", value: "", result: false},
+		{name: "service name", value: "amqp", result: false},
+		{name: "nil value", value: nil, result: false},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+
+			portValidator := NewPortValidator()
+
+			expectedResult := test.result
+			actualResult, _ := portValidator.Evaluate(test.value)
+			assert.Assert(t, reflect.DeepEqual(actualResult, expectedResult))
+		})
+	}
+}
+
 func TestTimeoutInSecondsValidator_Evaluate(t *testing.T) {
 	type test struct {
 		name   string
@@ -0,0 +1,28 @@
+package watch
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Kubernetes projects ConfigMaps and Secrets with an atomic writer: the files
+// live in a timestamped ..<timestamp> directory, ..data is a symlink to it and
+// each visible file or directory is a symlink through ..data. An update writes
+// a new directory and renames a new symlink over ..data, so the visible files
+// themselves never see an event.
+const atomicWriterData = "..data"
+
+// isAtomicWriterEntry returns true for the hidden entries of the atomic writer
+// (..data and the timestamped directories), which are not content.
+func isAtomicWriterEntry(name string) bool {
+	return strings.HasPrefix(name, "..")
+}
+
+// isAtomicSwap returns true if event is the ..data symlink of dir being
+// replaced.
+func isAtomicSwap(event fsnotify.Event, dir string) bool {
+	return filepath.Clean(event.Name) == filepath.Join(dir, atomicWriterData) &&
+		event.Op&(fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0
+}
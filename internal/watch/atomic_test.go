@@ -0,0 +1,125 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datasance/router/internal/qdr"
+)
+
+// atomicWrite updates dir the way the kubelet updates a ConfigMap or Secret
+// volume: files are written to a new timestamped directory, a temporary
+// symlink to it is renamed over ..data and the previous directory is removed.
+// Top-level entries are symlinks through ..data.
+func atomicWrite(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	previous, _ := os.Readlink(filepath.Join(dir, atomicWriterData))
+	ts, err := os.MkdirTemp(dir, "..ts_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(ts, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(ts), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, atomicWriterData)); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		top := strings.Split(name, "/")[0]
+		link := filepath.Join(dir, top)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err := os.Symlink(filepath.Join(atomicWriterData, top), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if previous != "" {
+		if err := os.RemoveAll(filepath.Join(dir, previous)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watcher")
+	}
+	var zero T
+	return zero
+}
+
+func TestWatchConfigFileAtomicSwap(t *testing.T) {
+	dir := t.TempDir()
+	atomicWrite(t, dir, map[string]string{"skrouterd.json": "v1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan string, 10)
+	go WatchConfigFile(ctx, filepath.Join(dir, "skrouterd.json"), func(configJSON string) error {
+		updates <- configJSON
+		return nil
+	})
+	// Let the watch be established
+	time.Sleep(100 * time.Millisecond)
+
+	atomicWrite(t, dir, map[string]string{"skrouterd.json": "v2"})
+	if got := receive(t, updates); got != "v2" {
+		t.Errorf("config = %q, want v2", got)
+	}
+}
+
+func TestWatchSSLProfileDirAtomicSwap(t *testing.T) {
+	base := t.TempDir()
+	// Profile a is projected into base; profile b is a volume of its own
+	atomicWrite(t, base, map[string]string{"a/ca.crt": "a1"})
+	b := filepath.Join(base, "b")
+	if err := os.Mkdir(b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	atomicWrite(t, b, map[string]string{"ca.crt": "b1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan *qdr.SslProfileDifference, 10)
+	go WatchSSLProfileDir(ctx, base, nil, func(changes *qdr.SslProfileDifference) {
+		updates <- changes
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	atomicWrite(t, base, map[string]string{"a/ca.crt": "a2"})
+	changes := receive(t, updates)
+	if len(changes.Updated) != 1 || changes.Updated[0].Name != "a" || len(changes.Added) != 0 || len(changes.Deleted) != 0 {
+		t.Fatalf("first rescan = %+v, want a updated and no atomic writer entries", changes)
+	}
+	if changes.Updated[0].CaCertFile != filepath.Join(base, "a", "ca.crt") {
+		t.Errorf("CaCertFile = %q, want the path through the symlink", changes.Updated[0].CaCertFile)
+	}
+
+	atomicWrite(t, b, map[string]string{"ca.crt": "b2"})
+	if changes := receive(t, updates); len(changes.Updated) != 1 || changes.Updated[0].Name != "b" {
+		t.Errorf("swap in profile dir = %+v, want b updated", changes)
+	}
+
+	// Later swaps of base are picked up as well
+	atomicWrite(t, base, map[string]string{"a/ca.crt": "a3"})
+	if changes := receive(t, updates); len(changes.Updated) != 1 || changes.Updated[0].Name != "a" {
+		t.Errorf("swap of base = %+v, want a updated", changes)
+	}
+}
@@ -13,8 +13,9 @@ import (
 
 const configDebounceDuration = 500 * time.Millisecond
 
-// WatchConfigFile watches the config file at configPath for changes. On write/create
-// (after debounce), it reads the file and calls onUpdate with the content. Loop
+// WatchConfigFile watches the config file at configPath for changes. On write/create, or
+// when a Kubernetes volume swaps its ..data symlink (after debounce), it reads the file
+// and calls onUpdate with the content. Loop
 // prevention is the caller's responsibility: compare content with last applied and
 // skip calling UpdateRouter if unchanged. Runs until ctx is cancelled.
 func WatchConfigFile(ctx context.Context, configPath string, onUpdate func(configJSON string) error) {
@@ -69,7 +70,13 @@ func WatchConfigFile(ctx context.Context, configPath string, onUpdate func(confi
 			if !ok {
 				return
 			}
-			// We watch the directory; only react to changes to our config file
+			// We watch the directory; only react to changes to our config file,
+			// or to a swap of the ..data symlink it resolves through when mounted
+			// from a ConfigMap or Secret
+			if isAtomicSwap(event, dir) {
+				scheduleRead()
+				continue
+			}
 			if filepath.Clean(event.Name) != filepath.Clean(configPath) {
 				continue
 			}
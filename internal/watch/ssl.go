@@ -2,9 +2,13 @@ package watch
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -28,11 +32,11 @@ func ScanSSLProfileDir(basePath string) (map[string]qdr.SslProfile, error) {
 	}
 	profiles := make(map[string]qdr.SslProfile)
 	for _, e := range entries {
-		if !e.IsDir() {
-			continue
-		}
 		name := e.Name()
 		dir := filepath.Join(basePath, name)
+		if !isProfileDir(e, dir) {
+			continue
+		}
 		caPath := filepath.Join(dir, "ca.crt")
 		certPath := filepath.Join(dir, "tls.crt")
 		keyPath := filepath.Join(dir, "tls.key")
@@ -54,9 +58,83 @@ func ScanSSLProfileDir(basePath string) (map[string]qdr.SslProfile, error) {
 	return profiles, nil
 }
 
+// isProfileDir returns true if the entry is a directory or, as in a projected
+// Kubernetes volume, a symlink to one. The atomic writer's own entries are not.
+func isProfileDir(e os.DirEntry, path string) bool {
+	if isAtomicWriterEntry(e.Name()) {
+		return false
+	}
+	if e.IsDir() {
+		return true
+	}
+	if e.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// sslProfileDir is the result of scanning the SSL profile directory, with a
+// digest of the files of each profile so rotated certs are noticed.
+type sslProfileDir struct {
+	profiles map[string]qdr.SslProfile
+	digests  map[string]string
+}
+
+func scanSSLProfileDir(basePath string) (sslProfileDir, error) {
+	profiles, err := ScanSSLProfileDir(basePath)
+	if err != nil {
+		return sslProfileDir{}, err
+	}
+	dir := sslProfileDir{profiles: profiles, digests: make(map[string]string)}
+	for name, profile := range profiles {
+		dir.digests[name] = profileDigest(profile)
+	}
+	return dir, nil
+}
+
+// profileDigest returns a hash of the content of the profile's files. A file
+// that cannot be read is hashed as empty, so it changes once it can be.
+func profileDigest(profile qdr.SslProfile) string {
+	h := sha256.New()
+	for _, path := range []string{profile.CaCertFile, profile.CertFile, profile.PrivateKeyFile} {
+		if path == "" {
+			continue
+		}
+		data, _ := os.ReadFile(path)
+		sum := sha256.Sum256(data)
+		h.Write([]byte(path))
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// difference returns the profiles that were added to, changed in and removed
+// from the directory since the previous scan.
+func (previous sslProfileDir) difference(current sslProfileDir) *qdr.SslProfileDifference {
+	result := qdr.SslProfileDifference{}
+	for _, name := range slices.Sorted(maps.Keys(current.profiles)) {
+		profile := current.profiles[name]
+		if old, ok := previous.profiles[name]; !ok {
+			result.Added = append(result.Added, profile)
+		} else if old != profile || previous.digests[name] != current.digests[name] {
+			result.Updated = append(result.Updated, profile)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(previous.profiles)) {
+		if _, ok := current.profiles[name]; !ok {
+			result.Deleted = append(result.Deleted, name)
+		}
+	}
+	return &result
+}
+
 // WatchSSLProfileDir watches basePath (and subdirs) for changes, debounces events,
-// then rescans and calls onUpdate with the new profiles map. Runs until ctx is cancelled.
-func WatchSSLProfileDir(ctx context.Context, basePath string, onUpdate func(profiles map[string]qdr.SslProfile)) {
+// then rescans and calls onUpdate with the profiles added, changed and removed
+// since the previous scan. Profiles present when the watch starts are passed
+// to onStart, if set, rather than reported as added. Runs until ctx is
+// cancelled.
+func WatchSSLProfileDir(ctx context.Context, basePath string, onStart func(profiles []qdr.SslProfile), onUpdate func(changes *qdr.SslProfileDifference)) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Printf("ERROR: Failed to create fsnotify watcher for SSL profile path: %v", err)
@@ -90,29 +168,62 @@ func WatchSSLProfileDir(ctx context.Context, basePath string, onUpdate func(prof
 		}
 		mu.Unlock()
 	}
-	// Initial scan of subdirs
-	if entries, err := os.ReadDir(basePath); err == nil {
-		for _, e := range entries {
-			if e.IsDir() {
-				addSubdir(filepath.Join(basePath, e.Name()))
+	// A removed or renamed subdir is watched again if it is created anew
+	removeSubdir := func(path string) {
+		mu.Lock()
+		if _, ok := subdirs[path]; ok {
+			delete(subdirs, path)
+			_ = watcher.Remove(path)
+		}
+		mu.Unlock()
+	}
+	// Symlinked subdirs are watched through the directory they resolved to,
+	// which is replaced when the ..data symlink of basePath is swapped
+	rewatchSubdirs := func() {
+		mu.Lock()
+		for path := range subdirs {
+			_ = watcher.Remove(path)
+			delete(subdirs, path)
+		}
+		mu.Unlock()
+		if entries, err := os.ReadDir(basePath); err == nil {
+			for _, e := range entries {
+				if path := filepath.Join(basePath, e.Name()); isProfileDir(e, path) {
+					addSubdir(path)
+				}
 			}
 		}
 	}
+	// Initial scan of subdirs
+	rewatchSubdirs()
 	var debounceTimer *time.Timer
 	var debounceMu sync.Mutex
+	// last is guarded by scanMu, which also keeps rescans from overlapping
+	last, err := scanSSLProfileDir(basePath)
+	if err != nil {
+		log.Printf("ERROR: Failed to scan SSL profile dir: %v", err)
+	}
+	if onStart != nil {
+		onStart(sslProfileDir{}.difference(last).Added)
+	}
+	var scanMu sync.Mutex
 	scheduleRescan := func() {
 		debounceMu.Lock()
 		if debounceTimer != nil {
 			debounceTimer.Stop()
 		}
 		debounceTimer = time.AfterFunc(debounceDuration, func() {
-			profiles, err := ScanSSLProfileDir(basePath)
+			scanMu.Lock()
+			defer scanMu.Unlock()
+			current, err := scanSSLProfileDir(basePath)
 			if err != nil {
 				log.Printf("ERROR: Failed to rescan SSL profile dir: %v", err)
 				return
 			}
-			if len(profiles) > 0 {
-				onUpdate(profiles)
+			changes := last.difference(current)
+			last = current
+			if !changes.Empty() {
+				onUpdate(changes)
 			}
 		})
 		debounceMu.Unlock()
@@ -125,10 +236,16 @@ func WatchSSLProfileDir(ctx context.Context, basePath string, onUpdate func(prof
 			if !ok {
 				return
 			}
-			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove) != 0 {
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
 				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && event.Op == fsnotify.Create {
 					addSubdir(event.Name)
 				}
+				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					removeSubdir(event.Name)
+				}
+				if isAtomicSwap(event, basePath) {
+					rewatchSubdirs()
+				}
 				scheduleRescan()
 			}
 		case err, ok := <-watcher.Errors:
@@ -1,9 +1,11 @@
 package watch
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/datasance/router/internal/qdr"
 )
@@ -110,3 +112,113 @@ func TestScanSSLProfileDir_ProfilesAreQdrSslProfile(t *testing.T) {
 		t.Fatalf("got %d profiles", len(profiles))
 	}
 }
+
+func TestSSLProfileDirDifference(t *testing.T) {
+	dir := t.TempDir()
+	write := func(profile string, file string, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, profile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, profile, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan := func() sslProfileDir {
+		t.Helper()
+		current, err := scanSSLProfileDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current
+	}
+	names := func(profiles []qdr.SslProfile) []string {
+		var result []string
+		for _, p := range profiles {
+			result = append(result, p.Name)
+		}
+		return result
+	}
+
+	write("a", "ca.crt", "a")
+	write("b", "ca.crt", "b")
+	first := scan()
+	changes := sslProfileDir{}.difference(first)
+	if got := names(changes.Added); len(got) != 2 || got[0] != "a" || got[1] != "b" || len(changes.Updated) != 0 || len(changes.Deleted) != 0 {
+		t.Fatalf("first scan = %+v, want a and b added", changes)
+	}
+	if !first.difference(scan()).Empty() {
+		t.Errorf("expected no changes when nothing changed")
+	}
+
+	// Rotated content, a new key file, a renamed and a removed profile
+	write("a", "ca.crt", "a2")
+	write("b", "tls.key", "key")
+	if err := os.Rename(filepath.Join(dir, "b"), filepath.Join(dir, "c")); err != nil {
+		t.Fatal(err)
+	}
+	changes = first.difference(scan())
+	if got := names(changes.Updated); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Updated = %v, want a", got)
+	}
+	if got := names(changes.Added); len(got) != 1 || got[0] != "c" || changes.Added[0].PrivateKeyFile == "" {
+		t.Errorf("Added = %+v, want c with its key", changes.Added)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "b" {
+		t.Errorf("Deleted = %v, want b", changes.Deleted)
+	}
+
+	// Removing every profile is reported too
+	for _, name := range []string{"a", "c"} {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changes := first.difference(scan()); len(changes.Deleted) != 2 {
+		t.Errorf("Deleted = %v, want a and b", changes.Deleted)
+	}
+}
+
+func TestWatchSSLProfileDirSkipsExistingProfiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "ca.crt"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan []qdr.SslProfile, 1)
+	updates := make(chan *qdr.SslProfileDifference, 10)
+	go WatchSSLProfileDir(ctx, dir, func(profiles []qdr.SslProfile) {
+		started <- profiles
+	}, func(changes *qdr.SslProfileDifference) {
+		updates <- changes
+	})
+	if profiles := receive(t, started); len(profiles) != 2 || profiles[0].Name != "a" || profiles[1].Name != "b" {
+		t.Fatalf("profiles at start = %+v, want a and b", profiles)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.MkdirAll(filepath.Join(dir, "c"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c", "ca.crt"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes := receive(t, updates)
+	if len(changes.Added) != 1 || changes.Added[0].Name != "c" || len(changes.Updated) != 0 || len(changes.Deleted) != 0 {
+		t.Errorf("changes = %+v, want only c added", changes)
+	}
+
+	// A profile present at start is reported once removed
+	if err := os.RemoveAll(filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if changes := receive(t, updates); len(changes.Deleted) != 1 || changes.Deleted[0] != "a" {
+		t.Errorf("changes = %+v, want a deleted", changes)
+	}
+}
@@ -18,13 +18,16 @@ import (
 	"errors"
 	"log"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	sdk "github.com/datasance/iofog-go-sdk/v3/pkg/microservices"
 	"github.com/datasance/router/internal/config"
 	qdr "github.com/datasance/router/internal/qdr"
 	rt "github.com/datasance/router/internal/router"
+	"github.com/datasance/router/internal/server"
 	"github.com/datasance/router/internal/watch"
 )
 
@@ -48,14 +51,49 @@ func init() {
 }
 
 func main() {
+	// Cancelled on SIGTERM/SIGINT, which stops the watchers and starts the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	go func() {
+		if err := server.NewServer(config.GetStatusAddress(), router).Run(ctx); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}()
 	if config.IsKubernetesRouterMode() {
-		runKubernetesMode()
+		runKubernetesMode(ctx)
 		return
 	}
-	runPotMode()
+	runPotMode(ctx)
+}
+
+// shutdown drains and stops the router process, then exits with its exit code.
+func shutdown(exitChannel <-chan error) {
+	log.Printf("INFO: Shutting down")
+	router.Shutdown(config.GetDrainTimeout())
+	if err := <-exitChannel; err != nil {
+		log.Fatalln(err.Error())
+	}
+	os.Exit(router.ExitCode())
 }
 
-func runKubernetesMode() {
+// parseRouterConfig parses the router config file. Unknown entity types and
+// attributes are rejected in strict mode (ROUTER_CONFIG_STRICT) and logged as
+// warnings otherwise.
+func parseRouterConfig(data string) (qdr.RouterConfig, error) {
+	qdrConfig, diagnostics, err := qdr.ParseRouterConfig(data)
+	if err != nil || len(diagnostics) == 0 {
+		return qdrConfig, err
+	}
+	if config.GetConfigStrict() {
+		return qdrConfig, &qdr.ConfigDiagnosticsError{Diagnostics: diagnostics}
+	}
+	for _, d := range diagnostics {
+		log.Printf("WARN: Ignoring router config %s", d)
+	}
+	return qdrConfig, nil
+}
+
+func runKubernetesMode(ctx context.Context) {
 	configPath := config.GetConfigPath()
 	// Config file is volume-mounted by the operator at QDROUTERD_CONF; retry briefly if not yet present.
 	var data []byte
@@ -71,7 +109,7 @@ func runKubernetesMode() {
 		}
 		log.Fatalf("Failed to read router config from %s: %v", configPath, err)
 	}
-	qdrConfig, err := qdr.UnmarshalRouterConfig(string(data))
+	qdrConfig, err := parseRouterConfig(string(data))
 	if err != nil {
 		log.Fatalf("Failed to unmarshal router config: %v", err)
 	}
@@ -84,24 +122,29 @@ func runKubernetesMode() {
 		LogConfig:   qdrConfig.LogConfig,
 		SiteConfig:  qdrConfig.SiteConfig,
 		Bridges:     qdrConfig.Bridges,
+		LinkRoutes:  qdrConfig.LinkRoutes,
+		AutoLinks:   qdrConfig.AutoLinks,
+		RawEntities: qdrConfig.RawEntities,
 	}
 	exitChannel := make(chan error)
-	go router.StartRouter(exitChannel)
-	ctx := context.Background()
+	go router.StartRouter(ctx, exitChannel)
 	var lastAppliedMu sync.Mutex
-	lastApplied := string(data)
+	lastApplied := qdrConfig
 	go watch.WatchConfigFile(ctx, configPath, func(configJSON string) error {
+		qdrConfig, err := parseRouterConfig(configJSON)
+		if err != nil {
+			log.Printf("ERROR: Failed to unmarshal router config from file: %v", err)
+			router.ConfigRejected(err)
+			return err
+		}
+		// Rewrites that only reorder or reformat the file change nothing
 		lastAppliedMu.Lock()
-		same := lastApplied == configJSON
+		same := lastApplied.Equals(qdrConfig)
 		lastAppliedMu.Unlock()
 		if same {
+			log.Printf("DEBUG: Router config file unchanged, skipping update")
 			return nil
 		}
-		qdrConfig, err := qdr.UnmarshalRouterConfig(configJSON)
-		if err != nil {
-			log.Printf("ERROR: Failed to unmarshal router config from file: %v", err)
-			return err
-		}
 		newConfig := &rt.Config{
 			Metadata:    qdrConfig.Metadata,
 			SslProfiles: qdrConfig.SslProfiles,
@@ -111,22 +154,33 @@ func runKubernetesMode() {
 			LogConfig:   qdrConfig.LogConfig,
 			SiteConfig:  qdrConfig.SiteConfig,
 			Bridges:     qdrConfig.Bridges,
+			LinkRoutes:  qdrConfig.LinkRoutes,
+			AutoLinks:   qdrConfig.AutoLinks,
+			RawEntities: qdrConfig.RawEntities,
 		}
 		if err := router.UpdateRouter(newConfig); err != nil {
 			log.Printf("ERROR: Failed to update router from config file: %v", err)
 			return err
 		}
 		lastAppliedMu.Lock()
-		lastApplied = configJSON
+		lastApplied = qdrConfig
 		lastAppliedMu.Unlock()
 		return nil
 	})
-	go watch.WatchSSLProfileDir(ctx, config.GetSSLProfilePath(), router.OnSSLProfilesFromDisk)
-	<-exitChannel
-	os.Exit(0)
+	go watch.WatchSSLProfileDir(ctx, config.GetSSLProfilePath(), router.OnSSLProfilesAtStart, router.OnSSLProfilesFromDisk)
+	go router.RunResync(ctx, config.GetResyncInterval())
+	select {
+	case err := <-exitChannel:
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		os.Exit(router.ExitCode())
+	case <-ctx.Done():
+		shutdown(exitChannel)
+	}
 }
 
-func runPotMode() {
+func runPotMode(ctx context.Context) {
 	ioFogClient, clientError := sdk.NewDefaultIoFogClient()
 	if clientError != nil {
 		log.Fatalln(clientError.Error())
@@ -136,13 +190,18 @@ func runPotMode() {
 	}
 	confChannel := ioFogClient.EstablishControlWsConnection(0)
 	exitChannel := make(chan error)
-	go router.StartRouter(exitChannel)
-	ctx := context.Background()
-	go watch.WatchSSLProfileDir(ctx, config.GetSSLProfilePath(), router.OnSSLProfilesFromDisk)
+	go router.StartRouter(ctx, exitChannel)
+	go watch.WatchSSLProfileDir(ctx, config.GetSSLProfilePath(), router.OnSSLProfilesAtStart, router.OnSSLProfilesFromDisk)
+	go router.RunResync(ctx, config.GetResyncInterval())
 	for {
 		select {
-		case <-exitChannel:
-			os.Exit(0)
+		case err := <-exitChannel:
+			if err != nil {
+				log.Fatalln(err.Error())
+			}
+			os.Exit(router.ExitCode())
+		case <-ctx.Done():
+			shutdown(exitChannel)
 		case <-confChannel:
 			newConfig := &rt.Config{
 				SslProfiles: make(map[string]qdr.SslProfile),
@@ -150,6 +209,8 @@ func runPotMode() {
 				Connectors:  make(map[string]qdr.Connector),
 				Addresses:   make(map[string]qdr.Address),
 				LogConfig:   make(map[string]qdr.LogConfig),
+				LinkRoutes:  make(map[string]qdr.LinkRoute),
+				AutoLinks:   make(map[string]qdr.AutoLink),
 				Bridges: qdr.BridgeConfig{
 					TcpListeners:  make(map[string]qdr.TcpEndpoint),
 					TcpConnectors: make(map[string]qdr.TcpEndpoint),